@@ -0,0 +1,67 @@
+// Команда tages-migrate переводит каталог хранилища из плоской раскладки
+// в раскладку storage.layout: sharded, а для backend: s3 сохраняет суммы
+// объектов, загруженных в бакет в обход сервера. Каталог и остальные
+// настройки берутся из той же конфигурации, что и у сервера. Сервер
+// на время переноса каталога нужно остановить.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/krekio/TagesTest/config"
+	"github.com/krekio/TagesTest/internal/storage"
+)
+
+func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to load the configuration: %v", err)
+	}
+	if cfg.Storage.Backend == "s3" {
+		fillDigests(cfg)
+		return
+	}
+	if cfg.Storage.Backend != "disk" || cfg.Server.StoragePath == storage.MemoryPath || cfg.Storage.Layout == "dedup" {
+		log.Fatalf("Only a bucket of the s3 backend or a storage directory of the disk backend in the flat or sharded layout can be migrated")
+	}
+	flat, err := storage.HasFlatFiles(cfg.Server.StoragePath)
+	if err != nil {
+		log.Fatalf("Failed to read the storage directory: %v", err)
+	}
+	if !flat {
+		log.Printf("%s has no files in the flat layout, nothing to migrate", cfg.Server.StoragePath)
+		return
+	}
+
+	start := time.Now()
+	log.Printf("Migrating %s to the sharded layout", cfg.Server.StoragePath)
+	moved, err := storage.MigrateToSharded(cfg.Server.StoragePath)
+	if err != nil {
+		log.Fatalf("Migration failed after moving %d files: %v", moved, err)
+	}
+	log.Printf("Moved %d files in %v, set storage.layout to sharded before starting the server",
+		moved, time.Since(start).Round(time.Millisecond))
+}
+
+// fillDigests сохраняет суммы объектов бакета, у которых их нет.
+func fillDigests(cfg *config.Config) {
+	s, err := storage.NewS3Storage(cfg.Storage.S3.StorageConfig())
+	if err != nil {
+		log.Fatalf("Failed to open the bucket: %v", err)
+	}
+	start := time.Now()
+	log.Printf("Saving checksums of objects in bucket %s", cfg.Storage.S3.Bucket)
+	filled, err := s.FillDigests(context.Background())
+	if err != nil {
+		log.Fatalf("Saving checksums failed after %d objects: %v", filled, err)
+	}
+	log.Printf("Saved checksums of %d objects in %v", filled, time.Since(start).Round(time.Millisecond))
+}
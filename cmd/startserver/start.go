@@ -2,35 +2,93 @@ package server
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/krekio/TagesTest/config"
+	"github.com/krekio/TagesTest/internal/rpclimit"
 	"github.com/krekio/TagesTest/internal/server"
 	"github.com/krekio/TagesTest/internal/storage"
 	pb "github.com/krekio/TagesTest/protos"
 	"google.golang.org/grpc"
 )
 
+// newBackend создаёт хранилище, выбранное в конфигурации.
+func newBackend(cfg *config.Config) (storage.Backend, error) {
+	filenameCharset, err := cfg.FilenameRegexp()
+	if err != nil {
+		return nil, err
+	}
+	opts := []storage.Option{
+		storage.WithNamePolicy(storage.NamePolicy{
+			MaxLength: cfg.Storage.MaxFilenameLength,
+			Charset:   filenameCharset,
+		}),
+		storage.WithContentPolicy(storage.ContentPolicy{ImageFormats: cfg.Storage.AllowedImageFormats}),
+		storage.WithQuota(storage.Quota{
+			MaxFileSize:  cfg.Storage.MaxFileSize,
+			MaxTotalSize: cfg.Storage.MaxTotalSize,
+		}),
+		storage.WithUploadSessionTTL(cfg.Storage.UploadSessionTTL),
+		storage.WithListSortLimit(cfg.Storage.ListSortLimit),
+	}
+
+	switch cfg.Storage.Backend {
+	case "disk":
+		if cfg.Server.StoragePath == storage.MemoryPath {
+			return storage.NewMemoryStorage(opts...), nil
+		}
+		switch cfg.Storage.Layout {
+		case "sharded":
+			return storage.NewShardedFileStorage(cfg.Server.StoragePath, opts...)
+		case "dedup":
+			return storage.NewDedupStorage(cfg.Server.StoragePath, opts...)
+		}
+		return storage.NewFileStorage(cfg.Server.StoragePath, opts...)
+	case "s3":
+		return storage.NewS3Storage(cfg.Storage.S3.StorageConfig(), opts...)
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+}
+
 func Run() {
-	cfg := config.NewDefaultConfig()
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Server.Port))
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to load the configuration: %v", err)
+	}
+
+	lis, err := net.Listen("tcp", net.JoinHostPort(cfg.Server.Host, strconv.Itoa(cfg.Server.Port)))
 	if err != nil {
 		log.Fatalf("Server startup error: %v", err)
 	}
 
-	fileStorage, err := storage.NewFileStorage(cfg.Server.StoragePath)
+	fileStorage, err := newBackend(cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize the file storage: %v", err)
 	}
 
+	limits := make(map[string]rpclimit.Limit, len(cfg.Limits.RPC))
+	for method, limit := range cfg.Limits.RPC {
+		limits[method] = rpclimit.Limit{PerClient: limit.PerClient, Global: limit.Global, WeightBytes: limit.WeightBytes}
+	}
+
 	grpcServer := grpc.NewServer()
-	pb.RegisterFileServiceServer(grpcServer, server.NewFileServiceServer(fileStorage))
+	pb.RegisterFileServiceServer(grpcServer, server.NewFileServiceServer(fileStorage,
+		server.WithLimits(limits),
+		server.WithQueue(cfg.Limits.MaxQueueWait, cfg.Limits.MaxQueueLength, cfg.Limits.RetryAfter),
+		server.WithTrustedClientID(cfg.Limits.TrustClientID),
+	))
 
 	// Канал для graceful shutdown
 	done := make(chan os.Signal, 1)
@@ -1,17 +1,137 @@
 package config
 
+import (
+	"regexp"
+	"time"
+
+	"github.com/krekio/TagesTest/internal/rpclimit"
+	"github.com/krekio/TagesTest/internal/s3"
+	"github.com/krekio/TagesTest/internal/storage"
+)
+
 type Config struct {
 	Server struct {
+		// Host - адрес, на котором слушает сервер, пусто - все интерфейсы.
 		Host        string `yaml:"host"`
 		Port        int    `yaml:"port"`
 		StoragePath string `yaml:"storage_path"`
 	} `yaml:"server"`
+	Storage struct {
+		// Backend - реализация хранилища: disk - файлы в каталоге StoragePath,
+		// а при StoragePath = ":memory:" - в памяти процесса; s3 - бакет
+		// S3-совместимого хранилища, см. S3.
+		Backend string `yaml:"backend"`
+		// Layout - раскладка файлов в каталоге для backend: disk. flat - каждый
+		// файл под своим именем, sharded - то же по подкаталогам ab/cd/ от хеша
+		// имени, для миллионов файлов; dedup - одинаковое содержимое хранится
+		// один раз, а имена ссылаются на него.
+		Layout string `yaml:"layout"`
+		// MaxFilenameLength - максимальная длина имени файла в байтах.
+		MaxFilenameLength int `yaml:"max_filename_length"`
+		// FilenamePattern - регулярное выражение, которому должно целиком
+		// соответствовать имя файла. Пустое значение разрешает любые символы.
+		FilenamePattern string `yaml:"filename_pattern"`
+		// AllowedImageFormats - форматы изображений, которые можно загружать
+		// (png, jpeg, gif, bmp, webp). Содержимое проверяется по сигнатуре
+		// и заголовку изображения, расширение имени должно совпадать с форматом.
+		// Пустой список отключает проверку и разрешает любые файлы.
+		AllowedImageFormats []string `yaml:"allowed_image_formats"`
+		// MaxFileSize - максимальный размер файла в байтах, 0 - без ограничения.
+		MaxFileSize int64 `yaml:"max_file_size"`
+		// MaxTotalSize - максимальный объём хранилища в байтах с учётом
+		// незавершённых загрузок, 0 - без ограничения.
+		MaxTotalSize int64 `yaml:"max_total_size"`
+		// UploadSessionTTL - время жизни сессии возобновляемой загрузки без активности.
+		UploadSessionTTL time.Duration `yaml:"upload_session_ttl"`
+		// ListSortLimit - сколько файлов ListFiles готов прочитать ради одной
+		// страницы при сортировке по дате или размеру, 0 - без ограничения.
+		ListSortLimit int      `yaml:"list_sort_limit"`
+		S3            S3Config `yaml:"s3"`
+	} `yaml:"storage"`
+	Limits struct {
+		// RPC - лимиты одновременных запросов по имени метода FileService.
+		RPC map[string]RPCLimit `yaml:"rpc"`
+		// MaxQueueWait - сколько запрос может ждать свободного слота, 0 - до отмены запроса.
+		MaxQueueWait time.Duration `yaml:"max_queue_wait"`
+		// MaxQueueLength - сколько запросов клиента может ждать слота, 0 - без ограничения.
+		MaxQueueLength int `yaml:"max_queue_length"`
+		// RetryAfter - подсказка клиенту, через сколько повторить отклонённый запрос.
+		RetryAfter time.Duration `yaml:"retry_after"`
+		// TrustClientID - считать лимиты по заголовку x-client-id, а не по
+		// адресу клиента. Включать только за доверенным прокси, который
+		// сам выставляет заголовок, иначе клиент обойдёт лимит, меняя его.
+		TrustClientID bool `yaml:"trust_client_id"`
+	} `yaml:"limits"`
+}
+
+// S3Config - подключение к S3-совместимому хранилищу для backend: s3.
+type S3Config struct {
+	// Endpoint - адрес хранилища, например https://s3.amazonaws.com.
+	// Бакет адресуется в пути запроса.
+	Endpoint string `yaml:"endpoint"`
+	Region   string `yaml:"region"`
+	Bucket   string `yaml:"bucket"`
+	// Prefix - общее начало ключей файлов в бакете, пусто - корень бакета.
+	Prefix string `yaml:"prefix"`
+	// AccessKeyID и SecretAccessKey - ключи доступа, пустые - без подписи.
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	// PartSize - размер части multipart-загрузки в байтах.
+	PartSize int64 `yaml:"part_size"`
+}
+
+// StorageConfig возвращает настройки бакета для storage.NewS3Storage.
+func (c *S3Config) StorageConfig() storage.S3Config {
+	return storage.S3Config{
+		Config: s3.Config{
+			Endpoint:        c.Endpoint,
+			Region:          c.Region,
+			Bucket:          c.Bucket,
+			AccessKeyID:     c.AccessKeyID,
+			SecretAccessKey: c.SecretAccessKey,
+		},
+		Prefix:   c.Prefix,
+		PartSize: c.PartSize,
+	}
+}
+
+// RPCLimit - лимиты одновременных запросов к одному методу.
+type RPCLimit struct {
+	PerClient int64 `yaml:"per_client"`
+	// Global - общий лимит для всех клиентов, 0 - без ограничения.
+	Global int64 `yaml:"global"`
+	// WeightBytes - объём файла, за который запрос занимает один слот,
+	// 0 - любой запрос занимает один слот.
+	WeightBytes int64 `yaml:"weight_bytes"`
 }
 
 func NewDefaultConfig() *Config {
 	cfg := &Config{}
-	cfg.Server.Host = "localhost"
 	cfg.Server.Port = 1488
 	cfg.Server.StoragePath = "./storage"
+	cfg.Storage.Backend = "disk"
+	cfg.Storage.Layout = "flat"
+	cfg.Storage.MaxFilenameLength = 200
+	cfg.Storage.UploadSessionTTL = 24 * time.Hour
+	cfg.Storage.ListSortLimit = 100000
+	cfg.Storage.AllowedImageFormats = []string{"png", "jpeg", "gif", "bmp", "webp"}
+	cfg.Storage.S3.Region = "us-east-1"
+	cfg.Storage.S3.PartSize = 8 << 20
+	cfg.Limits.RPC = make(map[string]RPCLimit)
+	for method, limit := range rpclimit.Defaults() {
+		cfg.Limits.RPC[method] = RPCLimit{PerClient: limit.PerClient, Global: limit.Global, WeightBytes: limit.WeightBytes}
+	}
+	cfg.Limits.MaxQueueWait = 30 * time.Second
+	cfg.Limits.MaxQueueLength = 100
+	cfg.Limits.RetryAfter = time.Second
 	return cfg
 }
+
+// FilenameRegexp возвращает FilenamePattern, привязанный к началу и концу имени,
+// или nil, если ограничение на набор символов не задано.
+func (c *Config) FilenameRegexp() (*regexp.Regexp, error) {
+	if c.Storage.FilenamePattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(`^(?:` + c.Storage.FilenamePattern + `)$`)
+}
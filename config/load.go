@@ -0,0 +1,337 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/krekio/TagesTest/internal/rpclimit"
+	"github.com/krekio/TagesTest/internal/storage"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix - префикс переменных окружения, переопределяющих конфигурацию.
+const EnvPrefix = "TAGES_"
+
+// binding связывает ключ конфигурации с флагом командной строки и
+// переменной окружения. Имя переменной получается из имени флага:
+// storage-path -> TAGES_STORAGE_PATH.
+type binding struct {
+	key   string
+	flag  string
+	usage string
+	set   func(cfg *Config, v string) error
+}
+
+func (b binding) env() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(b.flag, "-", "_"))
+}
+
+var bindings = []binding{
+	{"server.host", "host", "listen host, empty for all interfaces", func(c *Config, v string) error {
+		c.Server.Host = v
+		return nil
+	}},
+	{"server.port", "port", "listen port", func(c *Config, v string) error {
+		return setInt(&c.Server.Port, v)
+	}},
+	{"server.storage_path", "storage-path", "directory for stored files", func(c *Config, v string) error {
+		c.Server.StoragePath = v
+		return nil
+	}},
+	{"storage.backend", "storage-backend", "storage backend: disk or s3", func(c *Config, v string) error {
+		c.Storage.Backend = strings.TrimSpace(v)
+		return nil
+	}},
+	{"storage.layout", "storage-layout", "file layout for the disk backend: flat, sharded or dedup", func(c *Config, v string) error {
+		c.Storage.Layout = strings.TrimSpace(v)
+		return nil
+	}},
+	{"storage.max_filename_length", "max-filename-length", "maximum filename length in bytes", func(c *Config, v string) error {
+		return setInt(&c.Storage.MaxFilenameLength, v)
+	}},
+	{"storage.filename_pattern", "filename-pattern", "regular expression filenames must match", func(c *Config, v string) error {
+		c.Storage.FilenamePattern = v
+		return nil
+	}},
+	{"storage.allowed_image_formats", "allowed-image-formats", "comma-separated image formats allowed for upload, empty disables the check", func(c *Config, v string) error {
+		c.Storage.AllowedImageFormats = splitList(v)
+		return nil
+	}},
+	{"storage.max_file_size", "max-file-size", "maximum file size in bytes, 0 for no limit", func(c *Config, v string) error {
+		return setInt64(&c.Storage.MaxFileSize, v)
+	}},
+	{"storage.max_total_size", "max-total-size", "storage quota in bytes, 0 for no limit", func(c *Config, v string) error {
+		return setInt64(&c.Storage.MaxTotalSize, v)
+	}},
+	{"storage.upload_session_ttl", "upload-session-ttl", "lifetime of an idle resumable upload session", func(c *Config, v string) error {
+		return setDuration(&c.Storage.UploadSessionTTL, v)
+	}},
+	{"storage.list_sort_limit", "list-sort-limit", "maximum number of files ListFiles sorts by date or size, 0 for no limit", func(c *Config, v string) error {
+		return setInt(&c.Storage.ListSortLimit, v)
+	}},
+	{"storage.s3.endpoint", "s3-endpoint", "S3 endpoint URL", func(c *Config, v string) error {
+		c.Storage.S3.Endpoint = strings.TrimSpace(v)
+		return nil
+	}},
+	{"storage.s3.region", "s3-region", "S3 region", func(c *Config, v string) error {
+		c.Storage.S3.Region = strings.TrimSpace(v)
+		return nil
+	}},
+	{"storage.s3.bucket", "s3-bucket", "S3 bucket", func(c *Config, v string) error {
+		c.Storage.S3.Bucket = strings.TrimSpace(v)
+		return nil
+	}},
+	{"storage.s3.prefix", "s3-prefix", "key prefix for stored files in the S3 bucket", func(c *Config, v string) error {
+		c.Storage.S3.Prefix = v
+		return nil
+	}},
+	{"storage.s3.access_key_id", "s3-access-key-id", "S3 access key ID", func(c *Config, v string) error {
+		c.Storage.S3.AccessKeyID = strings.TrimSpace(v)
+		return nil
+	}},
+	{"storage.s3.secret_access_key", "s3-secret-access-key", "S3 secret access key", func(c *Config, v string) error {
+		c.Storage.S3.SecretAccessKey = strings.TrimSpace(v)
+		return nil
+	}},
+	{"storage.s3.part_size", "s3-part-size", "S3 multipart upload part size in bytes", func(c *Config, v string) error {
+		return setInt64(&c.Storage.S3.PartSize, v)
+	}},
+	{"limits.max_queue_wait", "max-queue-wait", "maximum time a request waits for a free slot", func(c *Config, v string) error {
+		return setDuration(&c.Limits.MaxQueueWait, v)
+	}},
+	{"limits.max_queue_length", "max-queue-length", "maximum number of queued requests per client", func(c *Config, v string) error {
+		return setInt(&c.Limits.MaxQueueLength, v)
+	}},
+	{"limits.retry_after", "retry-after", "retry hint for requests rejected by the limiter", func(c *Config, v string) error {
+		return setDuration(&c.Limits.RetryAfter, v)
+	}},
+	{"limits.trust_client_id", "trust-client-id", "count limits by the x-client-id header set by a trusted proxy", func(c *Config, v string) error {
+		return setBool(&c.Limits.TrustClientID, v)
+	}},
+}
+
+func setInt(dst *int, v string) error {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", v)
+	}
+	*dst = n
+	return nil
+}
+
+func setInt64(dst *int64, v string) error {
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", v)
+	}
+	*dst = n
+	return nil
+}
+
+func setBool(dst *bool, v string) error {
+	b, err := strconv.ParseBool(strings.TrimSpace(v))
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q", v)
+	}
+	*dst = b
+	return nil
+}
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func setDuration(dst *time.Duration, v string) error {
+	d, err := time.ParseDuration(strings.TrimSpace(v))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", v)
+	}
+	*dst = d
+	return nil
+}
+
+// Load собирает конфигурацию в порядке возрастания приоритета:
+// значения по умолчанию, YAML-файл (--config или TAGES_CONFIG),
+// переменные окружения TAGES_* и флаги командной строки.
+func Load(args []string) (*Config, error) {
+	cfg := NewDefaultConfig()
+
+	fs := flag.NewFlagSet("tages-server", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv(EnvPrefix+"CONFIG"), "path to YAML config file")
+	values := make(map[string]*string, len(bindings))
+	for _, b := range bindings {
+		values[b.flag] = fs.String(b.flag, "", fmt.Sprintf("%s (%s, env %s)", b.usage, b.key, b.env()))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configPath != "" {
+		if err := loadFile(cfg, *configPath); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, b := range bindings {
+		if v, ok := os.LookupEnv(b.env()); ok {
+			if err := b.set(cfg, v); err != nil {
+				return nil, &FieldError{Key: b.key, Source: b.env(), Msg: err.Error()}
+			}
+		}
+	}
+
+	// Флаги применяются только если они явно заданы, иначе пустые
+	// значения флагов затёрли бы настройки из файла и окружения.
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, b := range bindings {
+		if set[b.flag] {
+			if err := b.set(cfg, *values[b.flag]); err != nil {
+				return nil, &FieldError{Key: b.key, Source: "--" + b.flag, Msg: err.Error()}
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config %s: %w", path, err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return nil
+}
+
+// FieldError описывает некорректное значение конкретного ключа конфигурации.
+type FieldError struct {
+	Key    string
+	Source string
+	Msg    string
+}
+
+func (e *FieldError) Error() string {
+	if e.Source != "" {
+		return fmt.Sprintf("config %s (from %s): %s", e.Key, e.Source, e.Msg)
+	}
+	return fmt.Sprintf("config %s: %s", e.Key, e.Msg)
+}
+
+// Backends - поддерживаемые реализации хранилища.
+var Backends = []string{"disk", "s3"}
+
+// Layouts - поддерживаемые раскладки файлов в каталоге.
+var Layouts = []string{"flat", "sharded", "dedup"}
+
+// Validate проверяет итоговую конфигурацию.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, &FieldError{Key: "server.port", Msg: fmt.Sprintf("must be between 1 and 65535, got %d", c.Server.Port)})
+	}
+	if strings.TrimSpace(c.Server.StoragePath) == "" {
+		errs = append(errs, &FieldError{Key: "server.storage_path", Msg: "must not be empty"})
+	}
+	if !slices.Contains(Backends, c.Storage.Backend) {
+		errs = append(errs, &FieldError{Key: "storage.backend",
+			Msg: fmt.Sprintf("unknown backend %q, expected one of %s", c.Storage.Backend, strings.Join(Backends, ", "))})
+	}
+	if c.Storage.Backend == "s3" {
+		errs = append(errs, c.Storage.S3.validate()...)
+	}
+	if !slices.Contains(Layouts, c.Storage.Layout) {
+		errs = append(errs, &FieldError{Key: "storage.layout",
+			Msg: fmt.Sprintf("unknown layout %q, expected one of %s", c.Storage.Layout, strings.Join(Layouts, ", "))})
+	} else if c.Storage.Layout != "flat" && (c.Storage.Backend != "disk" || c.Server.StoragePath == ":memory:") {
+		errs = append(errs, &FieldError{Key: "storage.layout",
+			Msg: fmt.Sprintf("layout %q requires the disk backend with a storage directory", c.Storage.Layout)})
+	}
+	if c.Storage.MaxFilenameLength < 1 || c.Storage.MaxFilenameLength > 250 {
+		errs = append(errs, &FieldError{Key: "storage.max_filename_length", Msg: fmt.Sprintf("must be between 1 and 250, got %d", c.Storage.MaxFilenameLength)})
+	}
+	if _, err := c.FilenameRegexp(); err != nil {
+		errs = append(errs, &FieldError{Key: "storage.filename_pattern", Msg: err.Error()})
+	}
+	for i, format := range c.Storage.AllowedImageFormats {
+		if !slices.Contains(storage.ImageFormats, format) {
+			errs = append(errs, &FieldError{Key: fmt.Sprintf("storage.allowed_image_formats[%d]", i),
+				Msg: fmt.Sprintf("unknown format %q, expected one of %s", format, strings.Join(storage.ImageFormats, ", "))})
+		}
+	}
+	if c.Storage.UploadSessionTTL <= 0 {
+		errs = append(errs, &FieldError{Key: "storage.upload_session_ttl", Msg: fmt.Sprintf("must be positive, got %s", c.Storage.UploadSessionTTL)})
+	}
+	nonNegative := func(key string, v int64) {
+		if v < 0 {
+			errs = append(errs, &FieldError{Key: key, Msg: fmt.Sprintf("must not be negative, got %d", v)})
+		}
+	}
+	nonNegative("storage.max_file_size", c.Storage.MaxFileSize)
+	nonNegative("storage.max_total_size", c.Storage.MaxTotalSize)
+	nonNegative("storage.list_sort_limit", int64(c.Storage.ListSortLimit))
+	for _, method := range slices.Sorted(maps.Keys(c.Limits.RPC)) {
+		limit := c.Limits.RPC[method]
+		key := "limits.rpc." + method
+		if !rpclimit.IsLimited(method) {
+			errs = append(errs, &FieldError{Key: key, Msg: fmt.Sprintf("unknown method, expected one of %s",
+				strings.Join(slices.Sorted(maps.Keys(rpclimit.Defaults())), ", "))})
+			continue
+		}
+		if limit.PerClient < 1 {
+			errs = append(errs, &FieldError{Key: key + ".per_client", Msg: fmt.Sprintf("must be at least 1, got %d", limit.PerClient)})
+		}
+		nonNegative(key+".global", limit.Global)
+		nonNegative(key+".weight_bytes", limit.WeightBytes)
+	}
+	nonNegative("limits.max_queue_wait", int64(c.Limits.MaxQueueWait))
+	nonNegative("limits.max_queue_length", int64(c.Limits.MaxQueueLength))
+	nonNegative("limits.retry_after", int64(c.Limits.RetryAfter))
+	return errors.Join(errs...)
+}
+
+// validate проверяет настройки S3, если выбран backend s3.
+func (c *S3Config) validate() []error {
+	var errs []error
+	if u, err := url.Parse(c.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, &FieldError{Key: "storage.s3.endpoint", Msg: fmt.Sprintf("must be an http(s) URL, got %q", c.Endpoint)})
+	}
+	if c.Bucket == "" {
+		errs = append(errs, &FieldError{Key: "storage.s3.bucket", Msg: "must not be empty"})
+	}
+	if strings.HasPrefix(c.Prefix, "/") {
+		errs = append(errs, &FieldError{Key: "storage.s3.prefix", Msg: "must not start with /"})
+	}
+	if (c.AccessKeyID == "") != (c.SecretAccessKey == "") {
+		errs = append(errs, &FieldError{Key: "storage.s3.secret_access_key", Msg: "access key ID and secret access key must be set together"})
+	}
+	// Ограничения S3 на размер части multipart-загрузки.
+	if c.PartSize < 5<<20 || c.PartSize > 5<<30 {
+		errs = append(errs, &FieldError{Key: "storage.s3.part_size", Msg: fmt.Sprintf("must be between 5 MiB and 5 GiB, got %d", c.PartSize)})
+	}
+	return errs
+}
@@ -0,0 +1,237 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krekio/TagesTest/config"
+)
+
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fieldErrors разворачивает ошибку Load или Validate в список FieldError.
+func fieldErrors(t *testing.T, err error) []*config.FieldError {
+	t.Helper()
+	var errs []error
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	} else if err != nil {
+		errs = []error{err}
+	}
+	var out []*config.FieldError
+	for _, err := range errs {
+		var fe *config.FieldError
+		if !errors.As(err, &fe) {
+			t.Fatalf("error %v is not a FieldError", err)
+		}
+		out = append(out, fe)
+	}
+	return out
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.Port != 1488 || cfg.Storage.Backend != "disk" || cfg.Limits.RPC["UploadFile"].PerClient != 10 {
+		t.Fatalf("unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, `
+server:
+  host: file-host
+  port: 1000
+  storage_path: /from/file
+storage:
+  max_file_size: 10
+  upload_session_ttl: 1h
+limits:
+  rpc:
+    UploadFile:
+      per_client: 3
+`)
+	t.Setenv("TAGES_CONFIG", path)
+	t.Setenv("TAGES_PORT", "2000")
+	t.Setenv("TAGES_STORAGE_PATH", "/from/env")
+	t.Setenv("TAGES_UPLOAD_SESSION_TTL", "2h")
+
+	cfg, err := config.Load([]string{"--port", "3000", "--max-queue-length", "7"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	tests := []struct {
+		key       string
+		got, want any
+	}{
+		// Флаг важнее окружения и файла.
+		{"server.port", cfg.Server.Port, 3000},
+		{"limits.max_queue_length", cfg.Limits.MaxQueueLength, 7},
+		// Окружение важнее файла.
+		{"server.storage_path", cfg.Server.StoragePath, "/from/env"},
+		{"storage.upload_session_ttl", cfg.Storage.UploadSessionTTL, 2 * time.Hour},
+		// Файл важнее значений по умолчанию.
+		{"server.host", cfg.Server.Host, "file-host"},
+		{"storage.max_file_size", cfg.Storage.MaxFileSize, int64(10)},
+		{"limits.rpc.UploadFile.per_client", cfg.Limits.RPC["UploadFile"].PerClient, int64(3)},
+		// Не заданное нигде остаётся по умолчанию.
+		{"storage.max_filename_length", cfg.Storage.MaxFilenameLength, 200},
+		{"limits.rpc.ListFiles.per_client", cfg.Limits.RPC["ListFiles"].PerClient, int64(100)},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.key, tt.got, tt.want)
+		}
+	}
+
+	// --config важнее TAGES_CONFIG.
+	other := writeConfig(t, "server:\n  host: other-file\n")
+	cfg, err = config.Load([]string{"--config", other})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.Host != "other-file" {
+		t.Errorf("server.host = %q, want the value from --config", cfg.Server.Host)
+	}
+}
+
+func TestLoadParseErrors(t *testing.T) {
+	tests := []struct {
+		flag, value, key string
+	}{
+		{"port", "http", "server.port"},
+		{"max-filename-length", "long", "storage.max_filename_length"},
+		{"max-file-size", "1GB", "storage.max_file_size"},
+		{"max-total-size", "-", "storage.max_total_size"},
+		{"upload-session-ttl", "1 day", "storage.upload_session_ttl"},
+		{"list-sort-limit", "all", "storage.list_sort_limit"},
+		{"s3-part-size", "8M", "storage.s3.part_size"},
+		{"max-queue-wait", "30", "limits.max_queue_wait"},
+		{"max-queue-length", "many", "limits.max_queue_length"},
+		{"retry-after", "soon", "limits.retry_after"},
+		{"trust-client-id", "maybe", "limits.trust_client_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.flag, func(t *testing.T) {
+			_, err := config.Load([]string{"--" + tt.flag, tt.value})
+			errs := fieldErrors(t, err)
+			if len(errs) != 1 || errs[0].Key != tt.key || errs[0].Source != "--"+tt.flag {
+				t.Fatalf("Load with --%s %q: %v", tt.flag, tt.value, err)
+			}
+
+			env := config.EnvPrefix + strings.ToUpper(strings.ReplaceAll(tt.flag, "-", "_"))
+			t.Setenv(env, tt.value)
+			_, err = config.Load(nil)
+			errs = fieldErrors(t, err)
+			if len(errs) != 1 || errs[0].Key != tt.key || errs[0].Source != env {
+				t.Fatalf("Load with %s=%q: %v", env, tt.value, err)
+			}
+		})
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	for name, data := range map[string]string{
+		"unknown key": "server:\n  prot: 1000\n",
+		"wrong type":  "server:\n  port: high\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := config.Load([]string{"--config", writeConfig(t, data)}); err == nil {
+				t.Fatal("Load accepted an invalid file")
+			}
+		})
+	}
+	if _, err := config.Load([]string{"--config", filepath.Join(t.TempDir(), "missing.yaml")}); err == nil {
+		t.Fatal("Load accepted a missing file")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s3 := func(c *config.Config) {
+		c.Storage.Backend = "s3"
+		c.Storage.S3.Endpoint = "http://localhost:9000"
+		c.Storage.S3.Bucket = "files"
+	}
+	tests := []struct {
+		key    string
+		modify func(c *config.Config)
+	}{
+		{"server.port", func(c *config.Config) { c.Server.Port = 70000 }},
+		{"server.storage_path", func(c *config.Config) { c.Server.StoragePath = " " }},
+		{"storage.backend", func(c *config.Config) { c.Storage.Backend = "ftp" }},
+		{"storage.layout", func(c *config.Config) { c.Storage.Layout = "tree" }},
+		{"storage.layout", func(c *config.Config) {
+			c.Storage.Layout = "sharded"
+			c.Server.StoragePath = ":memory:"
+		}},
+		{"storage.max_filename_length", func(c *config.Config) { c.Storage.MaxFilenameLength = 0 }},
+		{"storage.filename_pattern", func(c *config.Config) { c.Storage.FilenamePattern = "(" }},
+		{"storage.allowed_image_formats[1]", func(c *config.Config) { c.Storage.AllowedImageFormats = []string{"png", "tiff"} }},
+		{"storage.max_file_size", func(c *config.Config) { c.Storage.MaxFileSize = -1 }},
+		{"storage.max_total_size", func(c *config.Config) { c.Storage.MaxTotalSize = -1 }},
+		{"storage.upload_session_ttl", func(c *config.Config) { c.Storage.UploadSessionTTL = 0 }},
+		{"storage.list_sort_limit", func(c *config.Config) { c.Storage.ListSortLimit = -1 }},
+		{"storage.s3.endpoint", func(c *config.Config) {
+			s3(c)
+			c.Storage.S3.Endpoint = "localhost:9000"
+		}},
+		{"storage.s3.bucket", func(c *config.Config) {
+			s3(c)
+			c.Storage.S3.Bucket = ""
+		}},
+		{"storage.s3.prefix", func(c *config.Config) {
+			s3(c)
+			c.Storage.S3.Prefix = "/files"
+		}},
+		{"storage.s3.secret_access_key", func(c *config.Config) {
+			s3(c)
+			c.Storage.S3.AccessKeyID = "key"
+		}},
+		{"storage.s3.part_size", func(c *config.Config) {
+			s3(c)
+			c.Storage.S3.PartSize = 1 << 20
+		}},
+		{"limits.rpc.Uploadfile", func(c *config.Config) { c.Limits.RPC["Uploadfile"] = config.RPCLimit{PerClient: 1} }},
+		{"limits.rpc.UploadFile.per_client", func(c *config.Config) { c.Limits.RPC["UploadFile"] = config.RPCLimit{} }},
+		{"limits.rpc.DownloadFile.global", func(c *config.Config) {
+			c.Limits.RPC["DownloadFile"] = config.RPCLimit{PerClient: 1, Global: -1}
+		}},
+		{"limits.rpc.DownloadFile.weight_bytes", func(c *config.Config) {
+			c.Limits.RPC["DownloadFile"] = config.RPCLimit{PerClient: 1, WeightBytes: -1}
+		}},
+		{"limits.max_queue_wait", func(c *config.Config) { c.Limits.MaxQueueWait = -time.Second }},
+		{"limits.max_queue_length", func(c *config.Config) { c.Limits.MaxQueueLength = -1 }},
+		{"limits.retry_after", func(c *config.Config) { c.Limits.RetryAfter = -time.Second }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			cfg := config.NewDefaultConfig()
+			tt.modify(cfg)
+			errs := fieldErrors(t, cfg.Validate())
+			if len(errs) != 1 || errs[0].Key != tt.key {
+				t.Fatalf("Validate = %v, want one error for %s", errs, tt.key)
+			}
+		})
+	}
+
+	// Ошибки всех полей возвращаются вместе.
+	cfg := config.NewDefaultConfig()
+	cfg.Server.Port = 0
+	cfg.Storage.MaxFileSize = -1
+	if errs := fieldErrors(t, cfg.Validate()); len(errs) != 2 {
+		t.Fatalf("Validate = %v, want two errors", errs)
+	}
+}
@@ -0,0 +1,234 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// DefaultIdleTTL - через сколько простаивающий лимитер клиента удаляется из памяти.
+const DefaultIdleTTL = 5 * time.Minute
+
+var (
+	// ErrQueueFull возвращается, если в очереди клиента уже ждёт
+	// максимальное количество запросов.
+	ErrQueueFull = errors.New("limiter: queue is full")
+	// ErrQueueTimeout возвращается, если слот не освободился за максимальное
+	// время ожидания в очереди.
+	ErrQueueTimeout = errors.New("limiter: queue wait timeout")
+)
+
+// Limiter ограничивает количество одновременных запросов от каждого клиента.
+// Семафоры клиентов создаются лениво при первом запросе и удаляются,
+// если клиент простаивает дольше idleTTL. Дополнительно может быть задан
+// общий лимит на все запросы сервера.
+type Limiter struct {
+	mu          sync.Mutex
+	limit       int64
+	idleTTL     time.Duration
+	maxWait     time.Duration
+	maxQueue    int
+	global      *semaphore.Weighted
+	globalLimit int64
+	clients     map[string]*client
+	lastSweep   time.Time
+	now         func() time.Time
+}
+
+type client struct {
+	sem *semaphore.Weighted
+	// active - сумма весов запросов, занимающих слоты.
+	active   int64
+	waiting  int
+	lastUsed time.Time
+}
+
+type Option func(*Limiter)
+
+// WithGlobalLimit задаёт общий лимит одновременных запросов для всех клиентов.
+// Значение 0 отключает общий лимит.
+func WithGlobalLimit(n int64) Option {
+	return func(l *Limiter) {
+		if n > 0 {
+			l.global = semaphore.NewWeighted(n)
+			l.globalLimit = n
+		}
+	}
+}
+
+// WithIdleTTL задаёт время простоя, после которого лимитер клиента удаляется.
+func WithIdleTTL(d time.Duration) Option {
+	return func(l *Limiter) {
+		if d > 0 {
+			l.idleTTL = d
+		}
+	}
+}
+
+// WithMaxQueueWait ограничивает время ожидания свободного слота.
+// 0 означает ожидание до отмены контекста запроса.
+func WithMaxQueueWait(d time.Duration) Option {
+	return func(l *Limiter) {
+		l.maxWait = d
+	}
+}
+
+// WithMaxQueueLength ограничивает количество запросов клиента, ожидающих
+// свободного слота. 0 означает очередь без ограничений.
+func WithMaxQueueLength(n int) Option {
+	return func(l *Limiter) {
+		l.maxQueue = n
+	}
+}
+
+func New(limit int64, opts ...Option) *Limiter {
+	l := &Limiter{
+		limit:   limit,
+		idleTTL: DefaultIdleTTL,
+		clients: make(map[string]*client),
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.lastSweep = l.now()
+	return l
+}
+
+// Acquire занимает weight слотов для клиента key. Вес больше лимита урезается
+// до лимита, чтобы тяжёлый запрос мог выполниться хотя бы в одиночку.
+// Ожидание прерывается при отмене ctx. Возвращаемую функцию release нужно
+// вызвать ровно один раз после завершения запроса.
+func (l *Limiter) Acquire(ctx context.Context, key string, weight int64) (release func(), err error) {
+	weight = l.clampWeight(weight)
+
+	c, err := l.checkout(key, weight)
+	if err != nil {
+		return nil, err
+	}
+
+	waitCtx := ctx
+	if l.maxWait > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, l.maxWait)
+		defer cancel()
+	}
+
+	if err := l.acquire(waitCtx, c, weight); err != nil {
+		l.checkin(c, 0)
+		if ctx.Err() == nil && waitCtx.Err() != nil {
+			return nil, ErrQueueTimeout
+		}
+		return nil, err
+	}
+	l.markActive(c, weight)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if l.global != nil {
+				l.global.Release(weight)
+			}
+			c.sem.Release(weight)
+			l.checkin(c, weight)
+		})
+	}, nil
+}
+
+func (l *Limiter) clampWeight(weight int64) int64 {
+	if weight < 1 {
+		weight = 1
+	}
+	if weight > l.limit {
+		weight = l.limit
+	}
+	if l.global != nil && weight > l.globalLimit {
+		weight = l.globalLimit
+	}
+	return weight
+}
+
+// acquire занимает сначала слоты клиента, потом общие. В обратном порядке
+// запросы клиента, упёршегося в свой лимит, ждали бы в очереди, заняв общие
+// слоты, и не пускали бы запросы других клиентов.
+func (l *Limiter) acquire(ctx context.Context, c *client, weight int64) error {
+	if err := c.sem.Acquire(ctx, weight); err != nil {
+		return err
+	}
+	if l.global != nil {
+		if err := l.global.Acquire(ctx, weight); err != nil {
+			c.sem.Release(weight)
+			return err
+		}
+	}
+	return nil
+}
+
+// Clients возвращает количество клиентов, для которых сейчас хранится лимитер.
+func (l *Limiter) Clients() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.clients)
+}
+
+// checkout ставит запрос в очередь клиента key, создавая клиента при необходимости.
+func (l *Limiter) checkout(key string, weight int64) (*client, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= l.idleTTL {
+		l.sweep(now)
+	}
+
+	c, ok := l.clients[key]
+	if !ok {
+		c = &client{sem: semaphore.NewWeighted(l.limit)}
+		l.clients[key] = c
+	}
+	// Запрос, который сразу получит слот, в очереди не ждёт, поэтому
+	// ограничение длины очереди применяется только когда все слоты заняты.
+	if l.maxQueue > 0 && c.active+weight > l.limit && c.waiting >= l.maxQueue {
+		c.lastUsed = now
+		return nil, ErrQueueFull
+	}
+	c.waiting++
+	c.lastUsed = now
+	return c, nil
+}
+
+func (l *Limiter) markActive(c *client, weight int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c.waiting--
+	c.active += weight
+}
+
+// checkin возвращает weight занятых слотов, либо убирает запрос
+// из очереди, если weight равен 0.
+func (l *Limiter) checkin(c *client, weight int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if weight > 0 {
+		c.active -= weight
+	} else {
+		c.waiting--
+	}
+	c.lastUsed = l.now()
+}
+
+// sweep удаляет лимитеры клиентов, у которых нет активных запросов
+// и которые простаивали дольше idleTTL. Вызывается под l.mu.
+func (l *Limiter) sweep(now time.Time) {
+	for key, c := range l.clients {
+		if c.active == 0 && c.waiting == 0 && now.Sub(c.lastUsed) >= l.idleTTL {
+			delete(l.clients, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,177 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Запросы клиента, ждущие своего лимита, не должны занимать общие слоты.
+func TestQueuedRequestsDoNotHoldGlobalSlots(t *testing.T) {
+	l := New(2, WithGlobalLimit(4))
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := l.Acquire(ctx, "noisy", 1); err != nil {
+			t.Fatalf("Acquire: %v", err)
+		}
+	}
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		go l.Acquire(waitCtx, "noisy", 1)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	quietCtx, cancelQuiet := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancelQuiet()
+	release, err := l.Acquire(quietCtx, "quiet", 1)
+	if err != nil {
+		t.Fatalf("Acquire for another client: %v", err)
+	}
+	release()
+}
+
+func TestGlobalLimit(t *testing.T) {
+	l := New(2, WithGlobalLimit(3), WithMaxQueueWait(20*time.Millisecond))
+	ctx := context.Background()
+
+	var releases []func()
+	for _, key := range []string{"a", "a", "b"} {
+		release, err := l.Acquire(ctx, key, 1)
+		if err != nil {
+			t.Fatalf("Acquire(%s): %v", key, err)
+		}
+		releases = append(releases, release)
+	}
+	if _, err := l.Acquire(ctx, "c", 1); err != ErrQueueTimeout {
+		t.Fatalf("Acquire over the global limit: %v, want %v", err, ErrQueueTimeout)
+	}
+
+	releases[0]()
+	release, err := l.Acquire(ctx, "c", 1)
+	if err != nil {
+		t.Fatalf("Acquire after release: %v", err)
+	}
+	release()
+}
+
+// waitQueued ждёт, пока в очереди клиента key окажется n запросов.
+func waitQueued(t *testing.T, l *Limiter, key string, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		l.mu.Lock()
+		c := l.clients[key]
+		queued := c != nil && c.waiting == n
+		l.mu.Unlock()
+		if queued {
+			return
+		}
+	}
+	t.Fatalf("%d requests of %s did not queue", n, key)
+}
+
+func TestIdleClientsEvicted(t *testing.T) {
+	now := time.Now()
+	l := New(1, WithIdleTTL(time.Minute))
+	l.now = func() time.Time { return now }
+	l.lastSweep = now
+	ctx := context.Background()
+
+	release, err := l.Acquire(ctx, "idle", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if _, err := l.Acquire(ctx, "busy", 1); err != nil {
+		t.Fatal(err)
+	}
+	if n := l.Clients(); n != 2 {
+		t.Fatalf("Clients = %d, want 2", n)
+	}
+
+	now = now.Add(30 * time.Second)
+	if _, err := l.Acquire(ctx, "recent", 1); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(45 * time.Second)
+	// Следующий запрос запускает очистку: простаивающий дольше idleTTL
+	// клиент удаляется, а занятый и недавний остаются, хотя тоже давно
+	// не приходили.
+	release, err = l.Acquire(ctx, "new", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	l.mu.Lock()
+	_, idle := l.clients["idle"]
+	_, busy := l.clients["busy"]
+	l.mu.Unlock()
+	if idle || !busy || l.Clients() != 3 {
+		t.Fatalf("after sweep: idle kept %v, busy kept %v, %d clients", idle, busy, l.Clients())
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	l := New(1, WithMaxQueueLength(1))
+	ctx := context.Background()
+
+	release, err := l.Acquire(ctx, "a", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued := make(chan error, 1)
+	go func() {
+		release, err := l.Acquire(ctx, "a", 1)
+		if err == nil {
+			release()
+		}
+		queued <- err
+	}()
+	waitQueued(t, l, "a", 1)
+
+	if _, err := l.Acquire(ctx, "a", 1); err != ErrQueueFull {
+		t.Fatalf("Acquire over the queue length: %v, want %v", err, ErrQueueFull)
+	}
+	// Очередь у каждого клиента своя.
+	other, err := l.Acquire(ctx, "b", 1)
+	if err != nil {
+		t.Fatalf("Acquire for another client: %v", err)
+	}
+	other()
+
+	release()
+	if err := <-queued; err != nil {
+		t.Fatalf("queued Acquire: %v", err)
+	}
+}
+
+func TestCancelWhileQueued(t *testing.T) {
+	l := New(1, WithMaxQueueWait(time.Minute), WithMaxQueueLength(1))
+	ctx := context.Background()
+
+	release, err := l.Acquire(ctx, "a", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitCtx, cancel := context.WithCancel(ctx)
+	queued := make(chan error, 1)
+	go func() {
+		_, err := l.Acquire(waitCtx, "a", 1)
+		queued <- err
+	}()
+	waitQueued(t, l, "a", 1)
+	cancel()
+	// Отмена запроса - не таймаут очереди.
+	if err := <-queued; err != context.Canceled {
+		t.Fatalf("cancelled Acquire: %v, want %v", err, context.Canceled)
+	}
+	waitQueued(t, l, "a", 0)
+
+	release()
+	release, err = l.Acquire(ctx, "a", 1)
+	if err != nil {
+		t.Fatalf("Acquire after cancellation: %v", err)
+	}
+	release()
+}
@@ -0,0 +1,39 @@
+// Package rpclimit описывает лимиты одновременных запросов к методам
+// FileService. Таблицу по умолчанию используют и сервер, и конфигурация,
+// поэтому она вынесена из пакета сервера.
+package rpclimit
+
+// Limit - лимиты одновременных запросов к одному методу.
+type Limit struct {
+	// PerClient - сколько слотов доступно одному клиенту.
+	PerClient int64
+	// Global - сколько слотов доступно всем клиентам вместе, 0 - без ограничения.
+	Global int64
+	// WeightBytes - объём файла, за который запрос занимает один слот:
+	// файл в 3*WeightBytes занимает три слота. 0 - любой запрос занимает один слот.
+	// Учитывается, если размер известен до начала запроса: для DownloadFile
+	// и UploadFileV2 с указанным размером.
+	WeightBytes int64
+}
+
+// Defaults возвращает лимиты по умолчанию для всех методов, которые
+// можно ограничить.
+func Defaults() map[string]Limit {
+	return map[string]Limit{
+		"UploadFile":   {PerClient: 10},
+		"DownloadFile": {PerClient: 10},
+		"ListFiles":    {PerClient: 100},
+		"DeleteFile":   {PerClient: 10},
+		"GetFileInfo":  {PerClient: 100},
+
+		"StartUpload":     {PerClient: 10},
+		"GetUploadStatus": {PerClient: 100},
+		"CommitUpload":    {PerClient: 10},
+	}
+}
+
+// IsLimited сообщает, можно ли задать лимит для метода method.
+func IsLimited(method string) bool {
+	_, ok := Defaults()[method]
+	return ok
+}
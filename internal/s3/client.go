@@ -0,0 +1,510 @@
+// Package s3 - минимальный клиент S3-совместимого объектного хранилища:
+// операции над объектами, постраничный список, multipart-загрузка и
+// подпись запросов AWS Signature Version 4. Бакет адресуется в пути
+// (path-style), что поддерживают AWS, MinIO, Ceph и другие реализации.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRegion используется, если регион не задан. Большинство
+// S3-совместимых хранилищ принимают его независимо от расположения.
+const DefaultRegion = "us-east-1"
+
+// Config - параметры подключения к бакету.
+type Config struct {
+	// Endpoint - адрес хранилища, например https://s3.amazonaws.com
+	// или http://localhost:9000.
+	Endpoint string
+	Region   string
+	Bucket   string
+	// AccessKeyID и SecretAccessKey - ключи доступа. Пустые - запросы
+	// отправляются без подписи.
+	AccessKeyID     string
+	SecretAccessKey string
+	// HTTPClient - клиент для запросов, nil - http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+type Client struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	http      *http.Client
+}
+
+func New(cfg Config) (*Client, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("s3 endpoint: %w", err)
+	}
+	if (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("s3 endpoint %q: expected http(s)://host[:port]", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3 bucket is not set")
+	}
+
+	c := &Client{
+		endpoint:  endpoint,
+		region:    cfg.Region,
+		bucket:    cfg.Bucket,
+		accessKey: cfg.AccessKeyID,
+		secretKey: cfg.SecretAccessKey,
+		http:      cfg.HTTPClient,
+	}
+	if c.region == "" {
+		c.region = DefaultRegion
+	}
+	if c.http == nil {
+		c.http = http.DefaultClient
+	}
+	return c, nil
+}
+
+// ObjectInfo - сведения об объекте из HEAD, GET или списка объектов.
+// ContentType и Metadata в списке не возвращаются.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	ContentType  string
+	// Metadata - пользовательские метаданные x-amz-meta-*, ключи в нижнем регистре.
+	Metadata map[string]string
+}
+
+// Part - загруженная часть multipart-загрузки.
+type Part struct {
+	Number int    `xml:"PartNumber"`
+	ETag   string `xml:"ETag"`
+}
+
+// PutObject сохраняет объект key с содержимым data.
+func (c *Client) PutObject(ctx context.Context, key string, data []byte, contentType string, meta map[string]string) error {
+	req := c.newRequest(http.MethodPut, key, nil)
+	req.body = data
+	setObjectHeaders(req.header, contentType, meta)
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	return drain(resp)
+}
+
+// HeadObject возвращает сведения об объекте без содержимого.
+func (c *Client) HeadObject(ctx context.Context, key string) (*ObjectInfo, error) {
+	resp, err := c.do(ctx, c.newRequest(http.MethodHead, key, nil))
+	if err != nil {
+		return nil, err
+	}
+	defer drain(resp)
+	return objectInfo(key, resp), nil
+}
+
+// GetObject читает length байт объекта начиная со смещения offset,
+// length = 0 - до конца объекта. Если ifMatch не пуст, запрос выполняется
+// только для версии объекта с этим ETag, иначе возвращается ошибка
+// с кодом 412, см. IsPreconditionFailed.
+func (c *Client) GetObject(ctx context.Context, key string, offset, length int64, ifMatch string) (io.ReadCloser, *ObjectInfo, error) {
+	req := c.newRequest(http.MethodGet, key, nil)
+	switch {
+	case length > 0:
+		req.header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	case offset > 0:
+		req.header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	if ifMatch != "" {
+		req.header.Set("If-Match", ifMatch)
+	}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Body, objectInfo(key, resp), nil
+}
+
+// DeleteObject удаляет объект. Удаление несуществующего объекта не ошибка.
+func (c *Client) DeleteObject(ctx context.Context, key string) error {
+	resp, err := c.do(ctx, c.newRequest(http.MethodDelete, key, nil))
+	if err != nil {
+		return err
+	}
+	return drain(resp)
+}
+
+// MaxCopySize - наибольший объект, который копируется одним CopyObject.
+// Объекты больше копируются по частям через UploadPartCopy.
+const MaxCopySize = 5 << 30
+
+// CopyObject копирует объект src в dst внутри бакета, заменяя тип
+// содержимого и метаданные. Если srcIfMatch не пуст, копируется только
+// версия src с этим ETag, иначе возвращается ошибка с кодом 412.
+func (c *Client) CopyObject(ctx context.Context, src, srcIfMatch, dst, contentType string, meta map[string]string) error {
+	req := c.newRequest(http.MethodPut, dst, nil)
+	c.setCopySource(req, src, srcIfMatch)
+	req.header.Set("X-Amz-Metadata-Directive", "REPLACE")
+	setObjectHeaders(req.header, contentType, meta)
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	// Копирование может завершиться ошибкой уже после ответа 200.
+	var result struct {
+		XMLName xml.Name
+		errorBody
+	}
+	return decodeResult(resp, &result)
+}
+
+// ListOptions - параметры ListObjects.
+type ListOptions struct {
+	Prefix string
+	// Delimiter группирует ключи с общим началом до разделителя в CommonPrefixes.
+	Delimiter string
+	// StartAfter - ключ, после которого начинается список.
+	StartAfter        string
+	ContinuationToken string
+	// MaxKeys - размер страницы, 0 - по умолчанию хранилища (обычно 1000).
+	MaxKeys int
+}
+
+type ListResult struct {
+	Objects        []ObjectInfo
+	CommonPrefixes []string
+	// NextContinuationToken пуст на последней странице.
+	NextContinuationToken string
+}
+
+// ListObjects возвращает страницу ключей бакета по возрастанию.
+func (c *Client) ListObjects(ctx context.Context, opts ListOptions) (*ListResult, error) {
+	query := url.Values{"list-type": {"2"}}
+	for k, v := range map[string]string{
+		"prefix":             opts.Prefix,
+		"delimiter":          opts.Delimiter,
+		"start-after":        opts.StartAfter,
+		"continuation-token": opts.ContinuationToken,
+	} {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+	if opts.MaxKeys > 0 {
+		query.Set("max-keys", strconv.Itoa(opts.MaxKeys))
+	}
+
+	resp, err := c.do(ctx, c.newRequest(http.MethodGet, "", query))
+	if err != nil {
+		return nil, err
+	}
+	var body struct {
+		Contents []struct {
+			Key          string
+			Size         int64
+			ETag         string
+			LastModified time.Time
+		}
+		CommonPrefixes []struct {
+			Prefix string
+		}
+		IsTruncated           bool
+		NextContinuationToken string
+	}
+	if err := decodeResult(resp, &body); err != nil {
+		return nil, err
+	}
+
+	res := &ListResult{}
+	for _, obj := range body.Contents {
+		res.Objects = append(res.Objects, ObjectInfo{Key: obj.Key, Size: obj.Size, ETag: obj.ETag, LastModified: obj.LastModified})
+	}
+	for _, p := range body.CommonPrefixes {
+		res.CommonPrefixes = append(res.CommonPrefixes, p.Prefix)
+	}
+	if body.IsTruncated {
+		if body.NextContinuationToken == "" {
+			return nil, errors.New("s3: truncated list without a continuation token")
+		}
+		res.NextContinuationToken = body.NextContinuationToken
+	}
+	return res, nil
+}
+
+// CreateMultipartUpload начинает загрузку объекта key по частям и
+// возвращает её идентификатор. Объект появляется в бакете только после
+// CompleteMultipartUpload.
+func (c *Client) CreateMultipartUpload(ctx context.Context, key, contentType string, meta map[string]string) (string, error) {
+	req := c.newRequest(http.MethodPost, key, url.Values{"uploads": {""}})
+	setObjectHeaders(req.header, contentType, meta)
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	var body struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := decodeResult(resp, &body); err != nil {
+		return "", err
+	}
+	if body.UploadID == "" {
+		return "", errors.New("s3: empty multipart upload id")
+	}
+	return body.UploadID, nil
+}
+
+// UploadPart загружает часть number (с 1) multipart-загрузки. Все части,
+// кроме последней, должны быть не меньше MinPartSize.
+func (c *Client) UploadPart(ctx context.Context, key, uploadID string, number int, data []byte) (Part, error) {
+	req := c.newRequest(http.MethodPut, key, partQuery(uploadID, number))
+	req.body = data
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return Part{}, err
+	}
+	defer drain(resp)
+	return Part{Number: number, ETag: resp.Header.Get("ETag")}, nil
+}
+
+// UploadPartCopy делает частью number диапазон [offset, offset+length)
+// объекта src. srcIfMatch - как у CopyObject.
+func (c *Client) UploadPartCopy(ctx context.Context, key, uploadID string, number int, src, srcIfMatch string, offset, length int64) (Part, error) {
+	req := c.newRequest(http.MethodPut, key, partQuery(uploadID, number))
+	c.setCopySource(req, src, srcIfMatch)
+	req.header.Set("X-Amz-Copy-Source-Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return Part{}, err
+	}
+	var body struct {
+		XMLName xml.Name
+		ETag    string
+		errorBody
+	}
+	if err := decodeResult(resp, &body); err != nil {
+		return Part{}, err
+	}
+	return Part{Number: number, ETag: body.ETag}, nil
+}
+
+// CompleteMultipartUpload собирает объект из частей parts по возрастанию номеров.
+func (c *Client) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) error {
+	data, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []Part   `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	req := c.newRequest(http.MethodPost, key, url.Values{"uploadId": {uploadID}})
+	req.body = data
+	req.header.Set("Content-Type", "application/xml")
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	// Как и CopyObject, сборка может завершиться ошибкой после ответа 200.
+	var result struct {
+		XMLName xml.Name
+		errorBody
+	}
+	return decodeResult(resp, &result)
+}
+
+// Upload - незавершённая multipart-загрузка.
+type Upload struct {
+	Key       string
+	UploadID  string `xml:"UploadId"`
+	Initiated time.Time
+}
+
+// ListMultipartUploads возвращает все незавершённые multipart-загрузки
+// ключей с началом prefix, читая список постранично.
+func (c *Client) ListMultipartUploads(ctx context.Context, prefix string) ([]Upload, error) {
+	var uploads []Upload
+	query := url.Values{"uploads": {""}}
+	if prefix != "" {
+		query.Set("prefix", prefix)
+	}
+	for {
+		resp, err := c.do(ctx, c.newRequest(http.MethodGet, "", query))
+		if err != nil {
+			return nil, err
+		}
+		var body struct {
+			Uploads            []Upload `xml:"Upload"`
+			IsTruncated        bool
+			NextKeyMarker      string
+			NextUploadIDMarker string `xml:"NextUploadIdMarker"`
+		}
+		if err := decodeResult(resp, &body); err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, body.Uploads...)
+		if !body.IsTruncated {
+			return uploads, nil
+		}
+		if body.NextKeyMarker == "" {
+			return nil, errors.New("s3: truncated upload list without a marker")
+		}
+		query.Set("key-marker", body.NextKeyMarker)
+		query.Set("upload-id-marker", body.NextUploadIDMarker)
+	}
+}
+
+// AbortMultipartUpload отменяет загрузку и удаляет загруженные части.
+func (c *Client) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	resp, err := c.do(ctx, c.newRequest(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}))
+	if err != nil {
+		return err
+	}
+	return drain(resp)
+}
+
+// MinPartSize - наименьший размер части multipart-загрузки, кроме последней.
+const MinPartSize = 5 << 20
+
+// MaxParts - наибольшее число частей в multipart-загрузке.
+const MaxParts = 10000
+
+func partQuery(uploadID string, number int) url.Values {
+	return url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+}
+
+func (c *Client) setCopySource(r *request, key, ifMatch string) {
+	r.header.Set("X-Amz-Copy-Source", "/"+c.bucket+"/"+escapePath(key))
+	if ifMatch != "" {
+		r.header.Set("X-Amz-Copy-Source-If-Match", ifMatch)
+	}
+}
+
+// request - запрос к бакету до подписи.
+type request struct {
+	method string
+	// key - ключ объекта, пустой для запросов к бакету.
+	key    string
+	query  url.Values
+	header http.Header
+	body   []byte
+}
+
+func (c *Client) newRequest(method, key string, query url.Values) *request {
+	return &request{method: method, key: key, query: query, header: make(http.Header)}
+}
+
+// do подписывает и отправляет запрос. Ответ с кодом не из 2xx
+// превращается в *Error, тело ответа при этом закрывается.
+func (c *Client) do(ctx context.Context, r *request) (*http.Response, error) {
+	u := *c.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + c.bucket
+	u.RawPath = escapePath(u.Path)
+	if r.key != "" {
+		u.Path += "/" + r.key
+		u.RawPath += "/" + escapePath(r.key)
+	}
+	u.RawQuery = canonicalQuery(r.query)
+
+	req, err := http.NewRequestWithContext(ctx, r.method, u.String(), bytes.NewReader(r.body))
+	if err != nil {
+		return nil, err
+	}
+	if len(r.body) == 0 {
+		req.Body, req.GetBody = http.NoBody, nil
+	}
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+	if len(r.body) > 0 {
+		sum := md5.Sum(r.body)
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	}
+	c.sign(req, r.body, time.Now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer drain(resp)
+		return nil, responseError(r, resp)
+	}
+	return resp, nil
+}
+
+func setObjectHeaders(h http.Header, contentType string, meta map[string]string) {
+	if contentType != "" {
+		h.Set("Content-Type", contentType)
+	}
+	for k, v := range meta {
+		h.Set("X-Amz-Meta-"+k, v)
+	}
+}
+
+func objectInfo(key string, resp *http.Response) *ObjectInfo {
+	info := &ObjectInfo{
+		Key:         key,
+		ETag:        resp.Header.Get("ETag"),
+		ContentType: resp.Header.Get("Content-Type"),
+		Metadata:    make(map[string]string),
+	}
+	info.LastModified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	// Для диапазона Content-Length - длина диапазона, а полный размер
+	// объекта - в Content-Range: bytes a-b/size.
+	info.Size = resp.ContentLength
+	if cr := resp.Header.Get("Content-Range"); cr != "" {
+		if _, total, ok := strings.Cut(cr, "/"); ok {
+			if size, err := strconv.ParseInt(total, 10, 64); err == nil {
+				info.Size = size
+			}
+		}
+	}
+	for k, v := range resp.Header {
+		if name, ok := strings.CutPrefix(k, "X-Amz-Meta-"); ok && len(v) > 0 {
+			info.Metadata[strings.ToLower(name)] = v[0]
+		}
+	}
+	return info
+}
+
+// decodeResult разбирает XML-ответ в v. Если вместо результата пришёл
+// документ <Error>, возвращает его как *Error.
+func decodeResult(resp *http.Response, v any) error {
+	defer drain(resp)
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var probe struct {
+		XMLName xml.Name
+		errorBody
+	}
+	if err := xml.Unmarshal(data, &probe); err != nil {
+		return fmt.Errorf("s3: malformed response: %w", err)
+	}
+	if probe.XMLName.Local == "Error" {
+		return &Error{StatusCode: resp.StatusCode, Code: probe.Code, Message: probe.Message}
+	}
+	return xml.Unmarshal(data, v)
+}
+
+func drain(resp *http.Response) error {
+	// Дочитываем тело, чтобы соединение вернулось в пул.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.Body.Close()
+}
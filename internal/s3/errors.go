@@ -0,0 +1,60 @@
+package s3
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Error - ответ хранилища с кодом ошибки.
+type Error struct {
+	StatusCode int
+	// Code - код ошибки S3, например NoSuchKey. Для ответов без тела,
+	// как на HEAD, пустой.
+	Code    string
+	Message string
+	Method  string
+	Key     string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("s3 %s %q: %d", e.Method, e.Key, e.StatusCode)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// errorBody - документ <Error> из ответа S3.
+type errorBody struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func responseError(r *request, resp *http.Response) error {
+	e := &Error{StatusCode: resp.StatusCode, Method: r.method, Key: r.key}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var body errorBody
+	if xml.Unmarshal(data, &body) == nil {
+		e.Code, e.Message = body.Code, body.Message
+	}
+	return e
+}
+
+// IsNotFound сообщает, что объекта или загрузки нет.
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
+
+// IsPreconditionFailed сообщает, что условие If-Match не выполнено:
+// объект заменили.
+func IsPreconditionFailed(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusPreconditionFailed
+}
@@ -0,0 +1,116 @@
+package s3test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// verify проверяет подпись запроса по AWS Signature Version 4, как это
+// делает S3: каноническая форма запроса строится заново по тому, что
+// пришло на сервер, а не берётся у клиента.
+func verify(r *http.Request, body []byte) error {
+	const algorithm = "AWS4-HMAC-SHA256"
+	auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), algorithm+" ")
+	if !ok {
+		return errors.New("missing or unsupported Authorization header")
+	}
+	fields := make(map[string]string)
+	for _, part := range strings.Split(auth, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		fields[k] = v
+	}
+
+	scope := strings.Split(fields["Credential"], "/")
+	if len(scope) != 5 || scope[3] != "s3" || scope[4] != "aws4_request" {
+		return fmt.Errorf("malformed credential %q", fields["Credential"])
+	}
+	if scope[0] != AccessKeyID {
+		return fmt.Errorf("unknown access key %q", scope[0])
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	if _, err := time.Parse("20060102T150405Z", amzDate); err != nil || !strings.HasPrefix(amzDate, scope[1]) {
+		return fmt.Errorf("X-Amz-Date %q does not match the credential scope", amzDate)
+	}
+	if r.Header.Get("X-Amz-Content-Sha256") != sha256Hex(body) {
+		return errors.New("payload hash mismatch")
+	}
+
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	if !slices.IsSorted(signed) || !slices.Contains(signed, "host") {
+		return fmt.Errorf("malformed signed headers %q", fields["SignedHeaders"])
+	}
+	for name := range r.Header {
+		if name := strings.ToLower(name); strings.HasPrefix(name, "x-amz-") && !slices.Contains(signed, name) {
+			return fmt.Errorf("header %s is not signed", name)
+		}
+	}
+	var headers strings.Builder
+	for _, name := range signed {
+		value := strings.Join(r.Header.Values(name), ",")
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + strings.Join(strings.Fields(value), " ") + "\n")
+	}
+
+	query, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		return err
+	}
+	var params []string
+	for k, values := range query {
+		for _, v := range values {
+			params = append(params, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	slices.Sort(params)
+
+	canonical := strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		strings.Join(params, "&"),
+		headers.String(),
+		fields["SignedHeaders"],
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	stringToSign := strings.Join([]string{algorithm, amzDate, strings.Join(scope[1:], "/"), sha256Hex([]byte(canonical))}, "\n")
+
+	key := []byte("AWS4" + SecretAccessKey)
+	for _, part := range scope[1:] {
+		key = hmacSHA256(key, part)
+	}
+	want := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	if !hmac.Equal([]byte(fields["Signature"]), []byte(want)) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+// uriEncode - URI-кодирование SigV4: без изменений остаются буквы,
+// цифры, -_.~ и, если не encodeSlash, "/".
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			strings.IndexByte("-_.~", c) >= 0 || c == '/' && !encodeSlash {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,526 @@
+// Package s3test - S3-совместимый сервер в памяти для тестов. Поддерживает
+// то подмножество API, которым пользуется пакет s3: объекты, диапазоны
+// и If-Match, копирование, ListObjectsV2 и multipart-загрузку со списком
+// незавершённых загрузок.
+//
+//	srv := s3test.NewServer("bucket")
+//	defer srv.Close()
+//	client, err := s3.New(srv.Config())
+package s3test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krekio/TagesTest/internal/s3"
+)
+
+// Ключи доступа, которые ожидает сервер.
+const (
+	AccessKeyID     = "test-access-key"
+	SecretAccessKey = "test-secret-key"
+)
+
+type Server struct {
+	*httptest.Server
+	Bucket string
+	// MinPartSize - наименьший размер части, кроме последней. По умолчанию
+	// s3.MinPartSize, тесты могут уменьшить его, чтобы проверять
+	// multipart-загрузку на небольших файлах.
+	MinPartSize int64
+
+	mu      sync.Mutex
+	objects map[string]*object
+	uploads map[string]*multipart
+}
+
+type object struct {
+	data         []byte
+	etag         string
+	contentType  string
+	meta         map[string]string
+	lastModified time.Time
+}
+
+type multipart struct {
+	key         string
+	contentType string
+	meta        map[string]string
+	parts       map[int]*object
+	initiated   time.Time
+}
+
+// NewServer запускает сервер с одним пустым бакетом.
+func NewServer(bucket string) *Server {
+	s := &Server{
+		Bucket:      bucket,
+		MinPartSize: s3.MinPartSize,
+		objects:     make(map[string]*object),
+		uploads:     make(map[string]*multipart),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Config возвращает настройки клиента для этого сервера.
+func (s *Server) Config() s3.Config {
+	return s3.Config{
+		Endpoint:        s.URL,
+		Bucket:          s.Bucket,
+		AccessKeyID:     AccessKeyID,
+		SecretAccessKey: SecretAccessKey,
+		HTTPClient:      s.Client(),
+	}
+}
+
+// Keys возвращает ключи всех объектов бакета по возрастанию.
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Sorted(maps.Keys(s.objects))
+}
+
+// Uploads возвращает число незавершённых multipart-загрузок.
+func (s *Server) Uploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.uploads)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if err := verify(r, body); err != nil {
+		writeError(w, http.StatusForbidden, "SignatureDoesNotMatch", err.Error())
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.Bucket {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", bucket)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := r.URL.Query()
+	switch {
+	case key == "" && r.Method == http.MethodGet && q.Has("uploads"):
+		s.listUploads(w, q)
+	case key == "" && r.Method == http.MethodGet:
+		s.list(w, q)
+	case key == "":
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		s.createUpload(w, r, key)
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		s.completeUpload(w, q.Get("uploadId"), key, body)
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		s.uploadPart(w, r, q, key, body)
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		delete(s.uploads, q.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		s.copy(w, r, key)
+	case r.Method == http.MethodPut:
+		s.objects[key] = newObject(body, r.Header)
+		w.Header().Set("ETag", s.objects[key].etag)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		s.get(w, r, key)
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+func newObject(data []byte, h http.Header) *object {
+	sum := md5.Sum(data)
+	return &object{
+		data:         data,
+		etag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		contentType:  h.Get("Content-Type"),
+		meta:         metadata(h),
+		lastModified: time.Now(),
+	}
+}
+
+func metadata(h http.Header) map[string]string {
+	meta := make(map[string]string)
+	for k, v := range h {
+		if name, ok := strings.CutPrefix(k, "X-Amz-Meta-"); ok {
+			meta[name] = v[0]
+		}
+	}
+	return meta
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request, key string) {
+	obj := s.objects[key]
+	if obj == nil {
+		writeError(w, http.StatusNotFound, "NoSuchKey", key)
+		return
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != obj.etag {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "If-Match")
+		return
+	}
+
+	h := w.Header()
+	h.Set("ETag", obj.etag)
+	h.Set("Last-Modified", obj.lastModified.UTC().Format(http.TimeFormat))
+	if obj.contentType != "" {
+		h.Set("Content-Type", obj.contentType)
+	}
+	for k, v := range obj.meta {
+		h.Set("X-Amz-Meta-"+k, v)
+	}
+
+	data, status := obj.data, http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" {
+		start, end, ok := parseRange(rng, int64(len(obj.data)))
+		if !ok {
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", rng)
+			return
+		}
+		data, status = obj.data[start:end+1], http.StatusPartialContent
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(obj.data)))
+	}
+	h.Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+// parseRange разбирает диапазон вида bytes=a-b или bytes=a-.
+func parseRange(rng string, size int64) (start, end int64, ok bool) {
+	spec, ok := strings.CutPrefix(rng, "bytes=")
+	if !ok {
+		return 0, 0, false
+	}
+	from, to, _ := strings.Cut(spec, "-")
+	start, err := strconv.ParseInt(from, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+	end = size - 1
+	if to != "" {
+		if end, err = strconv.ParseInt(to, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end, true
+}
+
+// source находит объект из заголовка X-Amz-Copy-Source.
+func (s *Server) source(w http.ResponseWriter, r *http.Request) *object {
+	src := strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/")
+	bucket, key, _ := strings.Cut(src, "/")
+	if bucket != s.Bucket {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", bucket)
+		return nil
+	}
+	key, err := url.PathUnescape(key)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "x-amz-copy-source")
+		return nil
+	}
+	obj := s.objects[key]
+	if obj == nil {
+		writeError(w, http.StatusNotFound, "NoSuchKey", key)
+		return nil
+	}
+	if ifMatch := r.Header.Get("X-Amz-Copy-Source-If-Match"); ifMatch != "" && ifMatch != obj.etag {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "x-amz-copy-source-if-match")
+		return nil
+	}
+	return obj
+}
+
+func (s *Server) copy(w http.ResponseWriter, r *http.Request, key string) {
+	src := s.source(w, r)
+	if src == nil {
+		return
+	}
+	if len(src.data) > s3.MaxCopySize {
+		writeError(w, http.StatusBadRequest, "InvalidRequest", "source too large for CopyObject")
+		return
+	}
+	obj := newObject(src.data, r.Header)
+	if r.Header.Get("X-Amz-Metadata-Directive") != "REPLACE" {
+		obj.contentType, obj.meta = src.contentType, src.meta
+	}
+	s.objects[key] = obj
+	writeXML(w, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		ETag         string
+		LastModified time.Time
+	}{ETag: obj.etag, LastModified: obj.lastModified.UTC()})
+}
+
+func (s *Server) createUpload(w http.ResponseWriter, r *http.Request, key string) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	uploadID := hex.EncodeToString(id)
+	s.uploads[uploadID] = &multipart{
+		key:         key,
+		contentType: r.Header.Get("Content-Type"),
+		meta:        metadata(r.Header),
+		parts:       make(map[int]*object),
+		initiated:   time.Now(),
+	}
+	writeXML(w, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Bucket   string
+		Key      string
+		UploadID string `xml:"UploadId"`
+	}{Bucket: s.Bucket, Key: key, UploadID: uploadID})
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, q url.Values, key string, body []byte) {
+	up := s.uploads[q.Get("uploadId")]
+	if up == nil || up.key != key {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", key)
+		return
+	}
+	number, err := strconv.Atoi(q.Get("partNumber"))
+	if err != nil || number < 1 || number > s3.MaxParts {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "partNumber")
+		return
+	}
+
+	if r.Header.Get("X-Amz-Copy-Source") == "" {
+		part := newObject(body, nil)
+		up.parts[number] = part
+		w.Header().Set("ETag", part.etag)
+		return
+	}
+
+	src := s.source(w, r)
+	if src == nil {
+		return
+	}
+	data := src.data
+	if rng := r.Header.Get("X-Amz-Copy-Source-Range"); rng != "" {
+		start, end, ok := parseRange(rng, int64(len(data)))
+		if !ok {
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", rng)
+			return
+		}
+		data = data[start : end+1]
+	}
+	part := newObject(slices.Clone(data), nil)
+	up.parts[number] = part
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CopyPartResult"`
+		ETag    string
+	}{ETag: part.etag})
+}
+
+func (s *Server) completeUpload(w http.ResponseWriter, uploadID, key string, body []byte) {
+	up := s.uploads[uploadID]
+	if up == nil || up.key != key {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", key)
+		return
+	}
+	var req struct {
+		Parts []s3.Part `xml:"Part"`
+	}
+	if err := xml.Unmarshal(body, &req); err != nil || len(req.Parts) == 0 {
+		writeError(w, http.StatusBadRequest, "MalformedXML", "no parts")
+		return
+	}
+
+	var data bytes.Buffer
+	for i, p := range req.Parts {
+		part := up.parts[p.Number]
+		if part == nil || part.etag != p.ETag || (i > 0 && p.Number <= req.Parts[i-1].Number) {
+			writeError(w, http.StatusBadRequest, "InvalidPart", strconv.Itoa(p.Number))
+			return
+		}
+		if i < len(req.Parts)-1 && int64(len(part.data)) < s.MinPartSize {
+			writeError(w, http.StatusBadRequest, "EntityTooSmall", strconv.Itoa(p.Number))
+			return
+		}
+		data.Write(part.data)
+	}
+
+	obj := newObject(data.Bytes(), nil)
+	obj.contentType, obj.meta = up.contentType, up.meta
+	obj.etag = fmt.Sprintf(`"%s-%d"`, strings.Trim(obj.etag, `"`), len(req.Parts))
+	s.objects[key] = obj
+	delete(s.uploads, uploadID)
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Key     string
+		ETag    string
+	}{Key: key, ETag: obj.etag})
+}
+
+func (s *Server) list(w http.ResponseWriter, q url.Values) {
+	get := q.Get
+	prefix, delimiter := get("prefix"), get("delimiter")
+	after := get("start-after")
+	if token := get("continuation-token"); token != "" {
+		key, err := hex.DecodeString(token)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidArgument", "continuation-token")
+			return
+		}
+		after = string(key)
+	}
+	maxKeys := 1000
+	if v := get("max-keys"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n < maxKeys {
+			maxKeys = n
+		}
+	}
+
+	type content struct {
+		Key          string
+		Size         int64
+		ETag         string
+		LastModified time.Time
+	}
+	type commonPrefix struct {
+		Prefix string
+	}
+	var res struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []content
+		CommonPrefixes        []commonPrefix
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}
+
+	count, last := 0, ""
+	for _, key := range slices.Sorted(maps.Keys(s.objects)) {
+		if key <= after || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if count == maxKeys {
+			res.IsTruncated = true
+			break
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				p := key[:len(prefix)+i+len(delimiter)]
+				if n := len(res.CommonPrefixes); n == 0 || res.CommonPrefixes[n-1].Prefix != p {
+					res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{p})
+					// Следующая страница начинается после всех ключей с этим префиксом.
+					last = p + "\xff"
+					count++
+				}
+				continue
+			}
+		}
+		obj := s.objects[key]
+		res.Contents = append(res.Contents, content{key, int64(len(obj.data)), obj.etag, obj.lastModified.UTC()})
+		last = key
+		count++
+	}
+	if res.IsTruncated {
+		res.NextContinuationToken = hex.EncodeToString([]byte(last))
+	}
+	writeXML(w, res)
+}
+
+// listUploads отвечает на ListMultipartUploads. Загрузки упорядочены
+// по ключу и идентификатору, страница - не больше max-uploads.
+func (s *Server) listUploads(w http.ResponseWriter, q url.Values) {
+	maxUploads := 1000
+	if v := q.Get("max-uploads"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n < maxUploads {
+			maxUploads = n
+		}
+	}
+
+	type upload struct {
+		Key       string
+		UploadID  string `xml:"UploadId"`
+		Initiated time.Time
+	}
+	var all []upload
+	for id, up := range s.uploads {
+		if strings.HasPrefix(up.key, q.Get("prefix")) {
+			all = append(all, upload{up.key, id, up.initiated.UTC()})
+		}
+	}
+	slices.SortFunc(all, func(a, b upload) int {
+		return strings.Compare(a.Key+"\x00"+a.UploadID, b.Key+"\x00"+b.UploadID)
+	})
+
+	var res struct {
+		XMLName            xml.Name `xml:"ListMultipartUploadsResult"`
+		Bucket             string
+		Uploads            []upload `xml:"Upload"`
+		IsTruncated        bool
+		NextKeyMarker      string `xml:",omitempty"`
+		NextUploadIDMarker string `xml:"NextUploadIdMarker,omitempty"`
+	}
+	res.Bucket = s.Bucket
+	keyMarker, idMarker := q.Get("key-marker"), q.Get("upload-id-marker")
+	for _, up := range all {
+		if up.Key < keyMarker || up.Key == keyMarker && (idMarker == "" || up.UploadID <= idMarker) {
+			continue
+		}
+		if len(res.Uploads) == maxUploads {
+			res.IsTruncated = true
+			break
+		}
+		res.Uploads = append(res.Uploads, up)
+	}
+	if res.IsTruncated {
+		last := res.Uploads[len(res.Uploads)-1]
+		res.NextKeyMarker, res.NextUploadIDMarker = last.Key, last.UploadID
+	}
+	writeXML(w, res)
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: msg})
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,111 @@
+package s3test_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/krekio/TagesTest/internal/s3"
+	"github.com/krekio/TagesTest/internal/s3/s3test"
+)
+
+func TestSignedRequests(t *testing.T) {
+	srv := s3test.NewServer("bucket")
+	defer srv.Close()
+	client, err := s3.New(srv.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Ключ с символами, которые кодируются в пути по-разному.
+	key := "dir/a b+(1)~фото.png"
+	if err := client.PutObject(ctx, key, []byte("data"), "image/png", map[string]string{"note": "x  y"}); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	body, _, err := client.GetObject(ctx, key, 1, 0, "")
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "ata" {
+		t.Fatalf("GetObject = %q", data)
+	}
+	body, _, err = client.GetObject(ctx, key, 1, 2, "")
+	if err != nil {
+		t.Fatalf("GetObject with length: %v", err)
+	}
+	data, _ = io.ReadAll(body)
+	body.Close()
+	if string(data) != "at" {
+		t.Fatalf("GetObject with length = %q", data)
+	}
+	res, err := client.ListObjects(ctx, s3.ListOptions{Prefix: "dir/a b", MaxKeys: 1})
+	if err != nil || len(res.Objects) != 1 {
+		t.Fatalf("ListObjects: %+v, %v", res, err)
+	}
+}
+
+func TestRejectsBadSignature(t *testing.T) {
+	srv := s3test.NewServer("bucket")
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		modify func(*s3.Config)
+	}{
+		{"wrong secret", func(c *s3.Config) { c.SecretAccessKey = "wrong" }},
+		{"unknown access key", func(c *s3.Config) { c.AccessKeyID = "other" }},
+		{"unsigned", func(c *s3.Config) { c.AccessKeyID, c.SecretAccessKey = "", "" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := srv.Config()
+			tt.modify(&cfg)
+			client, err := s3.New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = client.PutObject(context.Background(), "key", []byte("data"), "", nil)
+			var s3err *s3.Error
+			if !errors.As(err, &s3err) || s3err.StatusCode != http.StatusForbidden {
+				t.Fatalf("PutObject: %v, want 403", err)
+			}
+		})
+	}
+	if keys := srv.Keys(); len(keys) != 0 {
+		t.Fatalf("rejected requests stored %v", keys)
+	}
+}
+
+func TestListMultipartUploads(t *testing.T) {
+	srv := s3test.NewServer("bucket")
+	defer srv.Close()
+	client, err := s3.New(srv.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, key := range []string{"a/1", "a/2", "b/1"} {
+		if _, err := client.CreateMultipartUpload(ctx, key, "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	uploads, err := client.ListMultipartUploads(ctx, "a/")
+	if err != nil {
+		t.Fatalf("ListMultipartUploads: %v", err)
+	}
+	if len(uploads) != 2 || uploads[0].Key != "a/1" || uploads[1].Key != "a/2" || uploads[0].Initiated.IsZero() {
+		t.Fatalf("ListMultipartUploads = %+v", uploads)
+	}
+	if err := client.AbortMultipartUpload(ctx, uploads[0].Key, uploads[0].UploadID); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Uploads() != 2 {
+		t.Fatalf("%d uploads left, want 2", srv.Uploads())
+	}
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+
+	pb "github.com/krekio/TagesTest/protos"
+	"google.golang.org/grpc/metadata"
+)
+
+// SHA256Trailer - трейлер DownloadFile с SHA-256 (hex) отправленных байт,
+// по которому клиент проверяет, что получил данные без искажений.
+// Для скачивания диапазона это сумма диапазона, а не всего файла.
+const SHA256Trailer = "x-sha256"
+
+// hashingStream считает SHA-256 данных, отправляемых клиенту.
+type hashingStream struct {
+	pb.FileService_DownloadFileServer
+	hash        hash.Hash
+	notModified bool
+}
+
+func newHashingStream(stream pb.FileService_DownloadFileServer) *hashingStream {
+	return &hashingStream{FileService_DownloadFileServer: stream, hash: sha256.New()}
+}
+
+func (s *hashingStream) Send(resp *pb.DownloadFileResponse) error {
+	if err := s.FileService_DownloadFileServer.Send(resp); err != nil {
+		return err
+	}
+	s.hash.Write(resp.GetData())
+	s.notModified = s.notModified || resp.GetNotModified()
+	return nil
+}
+
+// setDigestTrailer добавляет в трейлеры сумму отправленных данных.
+// Для ответа not_modified тела нет, и сумма не отправляется.
+func (s *hashingStream) setDigestTrailer() {
+	if s.notModified {
+		return
+	}
+	s.SetTrailer(metadata.Pairs(SHA256Trailer, hex.EncodeToString(s.hash.Sum(nil))))
+}
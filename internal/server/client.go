@@ -0,0 +1,35 @@
+package server
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// ClientIDHeader - заголовок metadata, которым клиент может явно представиться.
+// Учитывается только с WithTrustedClientID, иначе клиент определяется по
+// адресу соединения.
+const ClientIDHeader = "x-client-id"
+
+// clientKey возвращает идентификатор клиента, по которому считаются лимиты.
+func (s *FileServiceServer) clientKey(ctx context.Context) string {
+	if s.trustClientID {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if ids := md.Get(ClientIDHeader); len(ids) > 0 && ids[0] != "" {
+				return "id:" + ids[0]
+			}
+		}
+	}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr := p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			return "addr:" + host
+		}
+		return "addr:" + addr
+	}
+
+	return "unknown"
+}
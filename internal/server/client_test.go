@@ -0,0 +1,38 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/krekio/TagesTest/internal/storage"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestClientKey(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 5000}
+	withPeer := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+	withID := metadata.NewIncomingContext(withPeer, metadata.Pairs(ClientIDHeader, "proxy-user"))
+
+	tests := []struct {
+		name  string
+		trust bool
+		ctx   context.Context
+		want  string
+	}{
+		{"peer address", false, withPeer, "addr:192.0.2.1"},
+		{"header ignored by default", false, withID, "addr:192.0.2.1"},
+		{"trusted header", true, withID, "id:proxy-user"},
+		{"trusted without header", true, withPeer, "addr:192.0.2.1"},
+		{"no peer", false, context.Background(), "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewFileServiceServer(storage.NewMemoryStorage(), WithTrustedClientID(tt.trust))
+			if got := s.clientKey(tt.ctx); got != tt.want {
+				t.Errorf("clientKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
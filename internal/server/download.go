@@ -0,0 +1,89 @@
+package server
+
+import (
+	"io"
+	"time"
+
+	"github.com/krekio/TagesTest/internal/storage"
+	pb "github.com/krekio/TagesTest/protos"
+	"google.golang.org/grpc/metadata"
+)
+
+// Заголовки ответа DownloadFile, отправляются до первого сообщения.
+const (
+	ETagHeader         = "etag"
+	LastModifiedHeader = "last-modified"
+)
+
+// downloadChunkSize - сколько байт файла отправляется в одном сообщении.
+const downloadChunkSize = 1024
+
+// downloadOptions переводит параметры DownloadFileRequest в параметры хранилища.
+func downloadOptions(req *pb.DownloadFileRequest) (storage.DownloadOptions, error) {
+	opts := storage.DownloadOptions{
+		Offset:      req.Offset,
+		Length:      req.Length,
+		IfNoneMatch: req.IfNoneMatch,
+	}
+
+	if req.IfModifiedSince != "" {
+		t, err := time.Parse(time.RFC3339, req.IfModifiedSince)
+		if err != nil {
+			return opts, invalidArgument("if_modified_since", "must be an RFC 3339 timestamp")
+		}
+		opts.IfModifiedSince = t
+	}
+	return opts, nil
+}
+
+// sendFile отправляет в стрим файл или его диапазон. ETag и дата изменения
+// отправляются в заголовках. Первое сообщение всегда содержит полный размер
+// файла, даже если диапазон пустой. Если сработало условие скачивания,
+// отправляется одно сообщение с not_modified = true без данных.
+func sendFile(obj storage.Object, opts storage.DownloadOptions, stream pb.FileService_DownloadFileServer) error {
+	info := obj.Info()
+	if err := stream.SendHeader(metadata.Pairs(
+		ETagHeader, info.ETag(),
+		LastModifiedHeader, info.UpdatedAt.Format(time.RFC3339),
+	)); err != nil {
+		return err
+	}
+
+	size := info.Size
+	if opts.NotModified(info) {
+		return stream.Send(&pb.DownloadFileResponse{TotalSize: size, NotModified: true})
+	}
+
+	length, err := opts.RangeLength(info)
+	if err != nil {
+		return err
+	}
+
+	first := true
+	buf := make([]byte, downloadChunkSize)
+	r := io.NewSectionReader(obj, opts.Offset, length)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			resp := &pb.DownloadFileResponse{Data: buf[:n]}
+			if first {
+				resp.TotalSize = size
+				first = false
+			}
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if first {
+		return stream.Send(&pb.DownloadFileResponse{TotalSize: size})
+	}
+	return nil
+}
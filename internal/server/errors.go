@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/krekio/TagesTest/internal/storage"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// toStatus переводит ошибку хранилища в статус gRPC с подробностями
+// из errdetails. Внутренние ошибки логируются, а клиенту отдаётся
+// codes.Internal без деталей файловой системы.
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "request canceled")
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "request deadline exceeded")
+	}
+
+	var serr *storage.Error
+	if !errors.As(err, &serr) {
+		log.Printf("Internal storage error: %v", err)
+		return status.Error(codes.Internal, "internal storage error")
+	}
+
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return withDetails(codes.NotFound, fmt.Sprintf("file %q not found", serr.Name), fileResource(serr))
+	case errors.Is(err, storage.ErrAlreadyExists):
+		return withDetails(codes.AlreadyExists, fmt.Sprintf("file %q already exists", serr.Name), fileResource(serr))
+	case errors.Is(err, storage.ErrInvalidName):
+		return withDetails(codes.InvalidArgument, fmt.Sprintf("invalid filename %q: %s", serr.Name, serr.Reason),
+			&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+				Field:       "filename",
+				Description: serr.Reason,
+			}}})
+	case errors.Is(err, storage.ErrSessionNotFound):
+		return withDetails(codes.NotFound, fmt.Sprintf("upload session %q not found or expired", serr.Name),
+			&errdetails.ResourceInfo{
+				ResourceType: "upload_session",
+				ResourceName: serr.Name,
+				Description:  serr.Kind.Error(),
+			})
+	case errors.Is(err, storage.ErrSessionBusy):
+		return status.Error(codes.Aborted, fmt.Sprintf("upload session %q is used by another request", serr.Name))
+	case errors.Is(err, storage.ErrOffsetMismatch):
+		return withDetails(codes.FailedPrecondition, fmt.Sprintf("upload offset must be %d", serr.Offset),
+			&errdetails.PreconditionFailure{Violations: []*errdetails.PreconditionFailure_Violation{{
+				Type:        "OFFSET",
+				Subject:     "offset",
+				Description: fmt.Sprintf("committed offset is %d", serr.Offset),
+			}}})
+	case errors.Is(err, storage.ErrInvalidContent):
+		return withDetails(codes.InvalidArgument, fmt.Sprintf("invalid content of file %q: %s", serr.Name, serr.Reason),
+			&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+				Field:       serr.Field,
+				Description: serr.Reason,
+			}}})
+	case errors.Is(err, storage.ErrInvalidArg):
+		return invalidArgument(serr.Field, serr.Reason)
+	case errors.Is(err, storage.ErrOutOfRange):
+		return withDetails(codes.OutOfRange, fmt.Sprintf("invalid range for file %q of %d bytes: %s %s", serr.Name, serr.Limit, serr.Field, serr.Reason),
+			&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+				Field:       serr.Field,
+				Description: serr.Reason,
+			}}})
+	case errors.Is(err, storage.ErrChecksumMismatch):
+		return withDetails(codes.DataLoss, fmt.Sprintf("checksum mismatch for file %q: %s %s", serr.Name, serr.Field, serr.Reason),
+			&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+				Field:       serr.Field,
+				Description: serr.Reason,
+			}}})
+	case errors.Is(err, storage.ErrPreconditionFailed):
+		return withDetails(codes.FailedPrecondition, fmt.Sprintf("precondition failed for file %q: %s", serr.Name, serr.Reason),
+			&errdetails.PreconditionFailure{Violations: []*errdetails.PreconditionFailure_Violation{{
+				Type:        "ETAG",
+				Subject:     "file:" + serr.Name,
+				Description: serr.Reason,
+			}}})
+	case errors.Is(err, storage.ErrQuotaExceeded):
+		return withDetails(codes.ResourceExhausted, fmt.Sprintf("storage quota of %d bytes exceeded", serr.Limit),
+			&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{
+				Subject:     "storage",
+				Description: fmt.Sprintf("total storage quota is %d bytes", serr.Limit),
+			}}})
+	case errors.Is(err, storage.ErrTooLarge):
+		return withDetails(codes.ResourceExhausted, fmt.Sprintf("file %q exceeds the maximum size of %d bytes", serr.Name, serr.Limit),
+			&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{
+				Subject:     "file:" + serr.Name,
+				Description: fmt.Sprintf("maximum file size is %d bytes", serr.Limit),
+			}}})
+	}
+
+	log.Printf("Internal storage error: %v", err)
+	return status.Error(codes.Internal, "internal storage error")
+}
+
+func invalidArgument(field, reason string) error {
+	return withDetails(codes.InvalidArgument, fmt.Sprintf("invalid %s: %s", field, reason),
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+			Field:       field,
+			Description: reason,
+		}}})
+}
+
+func fileResource(serr *storage.Error) *errdetails.ResourceInfo {
+	return &errdetails.ResourceInfo{
+		ResourceType: "file",
+		ResourceName: serr.Name,
+		Description:  serr.Kind.Error(),
+	}
+}
+
+func withDetails(code codes.Code, msg string, details ...protoadapt.MessageV1) error {
+	st := status.New(code, msg)
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
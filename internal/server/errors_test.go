@@ -0,0 +1,25 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/krekio/TagesTest/internal/storage"
+	pb "github.com/krekio/TagesTest/protos"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestInvalidNameStatus(t *testing.T) {
+	srv := NewFileServiceServer(storage.NewMemoryStorage())
+	for _, name := range []string{"../secret", "/etc/passwd", "a\x00b", "CON"} {
+		_, err := srv.GetFileInfo(context.Background(), &pb.GetFileInfoRequest{Filename: name})
+		if code := status.Code(err); code != codes.InvalidArgument {
+			t.Errorf("GetFileInfo(%q): code %v, want %v (%v)", name, code, codes.InvalidArgument, err)
+		}
+		_, err = srv.DeleteFile(context.Background(), &pb.DeleteFileRequest{Filename: name})
+		if code := status.Code(err); code != codes.InvalidArgument {
+			t.Errorf("DeleteFile(%q): code %v, want %v (%v)", name, code, codes.InvalidArgument, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/krekio/TagesTest/internal/limiter"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+type rpcLimiter struct {
+	*limiter.Limiter
+	weightBytes int64
+}
+
+// weight возвращает количество слотов для запроса над файлом размера size.
+func (l *rpcLimiter) weight(size int64) int64 {
+	if l.weightBytes <= 0 || size <= 0 {
+		return 1
+	}
+	return (size + l.weightBytes - 1) / l.weightBytes
+}
+
+// RetryAfterTrailer - трейлер с количеством секунд, через которое клиенту
+// стоит повторить отклонённый запрос.
+const RetryAfterTrailer = "retry-after"
+
+// acquire занимает слоты лимитера метода method для клиента запроса.
+// size - размер файла, по которому считается вес запроса, 0 если неизвестен.
+// Ожидание прерывается отменой или дедлайном запроса, а переполнение
+// очереди превращается в codes.ResourceExhausted с подсказкой о повторе.
+func (s *FileServiceServer) acquire(ctx context.Context, method string, size int64) (func(), error) {
+	l, ok := s.limiters[method]
+	if !ok {
+		return func() {}, nil
+	}
+
+	release, err := l.Acquire(ctx, s.clientKey(ctx), l.weight(size))
+	if err == nil {
+		return release, nil
+	}
+
+	if !errors.Is(err, limiter.ErrQueueFull) && !errors.Is(err, limiter.ErrQueueTimeout) {
+		return nil, toStatus(err)
+	}
+
+	seconds := int64(s.retryAfter.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	grpc.SetTrailer(ctx, metadata.Pairs(RetryAfterTrailer, strconv.FormatInt(seconds, 10)))
+
+	msg := "too many concurrent requests, queue is full"
+	if errors.Is(err, limiter.ErrQueueTimeout) {
+		msg = "too many concurrent requests, timed out waiting in queue"
+	}
+	return nil, withDetails(codes.ResourceExhausted, msg,
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(s.retryAfter)},
+		&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{
+			Subject:     "client:" + s.clientKey(ctx),
+			Description: "concurrent " + method + " request limit",
+		}}})
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/krekio/TagesTest/internal/rpclimit"
+	"github.com/krekio/TagesTest/internal/storage"
+	pb "github.com/krekio/TagesTest/protos"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestWithLimitsRejectsUnknownMethod(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("WithLimits accepted an unknown method")
+		}
+	}()
+	WithLimits(map[string]rpclimit.Limit{"Uploadfile": {PerClient: 1}})
+}
+
+// countingBackend считает вызовы, которые могут читать содержимое файла.
+type countingBackend struct {
+	storage.Backend
+	opened atomic.Int32
+	stats  atomic.Int32
+}
+
+func (b *countingBackend) Stat(ctx context.Context, name string) (*storage.FileInfo, error) {
+	b.stats.Add(1)
+	return b.Backend.Stat(ctx, name)
+}
+
+func (b *countingBackend) Open(ctx context.Context, name string) (storage.Object, error) {
+	b.opened.Add(1)
+	return b.Backend.Open(ctx, name)
+}
+
+type downloadStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *downloadStream) Context() context.Context            { return s.ctx }
+func (s *downloadStream) Send(*pb.DownloadFileResponse) error { return nil }
+func (s *downloadStream) SetHeader(metadata.MD) error         { return nil }
+func (s *downloadStream) SendHeader(metadata.MD) error        { return nil }
+func (s *downloadStream) SetTrailer(metadata.MD)              {}
+
+func TestDownloadOpensAfterAcquire(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingBackend{Backend: storage.NewMemoryStorage()}
+	if _, err := backend.Put(ctx, storage.UploadHeader{Name: "a.txt", Size: -1}, bytes.NewReader([]byte("data"))); err != nil {
+		t.Fatal(err)
+	}
+	srv := NewFileServiceServer(backend, WithLimits(map[string]rpclimit.Limit{"DownloadFile": {PerClient: 1}}),
+		WithQueue(50*time.Millisecond, 0, 0))
+
+	release, err := srv.acquire(ctx, "DownloadFile", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = srv.DownloadFile(&pb.DownloadFileRequest{Filename: "a.txt"}, &downloadStream{ctx: ctx})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("DownloadFile with a busy slot: %v, want %v", err, codes.ResourceExhausted)
+	}
+	if n, m := backend.opened.Load(), backend.stats.Load(); n != 0 || m != 0 {
+		t.Fatalf("file opened %d times and stat'ed %d times while waiting for a slot", n, m)
+	}
+	release()
+
+	if err := srv.DownloadFile(&pb.DownloadFileRequest{Filename: "a.txt"}, &downloadStream{ctx: ctx}); err != nil {
+		t.Fatal(err)
+	}
+	if n := backend.opened.Load(); n != 1 {
+		t.Fatalf("file opened %d times, want 1", n)
+	}
+}
+
+// trailerStream запоминает трейлеры, выставленные через grpc.SetTrailer.
+type trailerStream struct {
+	grpc.ServerTransportStream
+	trailer metadata.MD
+}
+
+func (s *trailerStream) Method() string { return "/FileService/GetFileInfo" }
+func (s *trailerStream) SetTrailer(md metadata.MD) error {
+	s.trailer = metadata.Join(s.trailer, md)
+	return nil
+}
+
+// requireRetryAfter проверяет отказ по лимиту с подсказкой о повторе через 2 секунды.
+func requireRetryAfter(t *testing.T, err error, stream *trailerStream, msg string) {
+	t.Helper()
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted || !strings.Contains(st.Message(), msg) {
+		t.Fatalf("acquire = %v, want ResourceExhausted with %q", err, msg)
+	}
+	if got := stream.trailer.Get(RetryAfterTrailer); len(got) != 1 || got[0] != "2" {
+		t.Fatalf("%s trailer = %v, want 2", RetryAfterTrailer, got)
+	}
+	var retry *errdetails.RetryInfo
+	for _, d := range st.Details() {
+		if r, ok := d.(*errdetails.RetryInfo); ok {
+			retry = r
+		}
+	}
+	if retry == nil || retry.RetryDelay.AsDuration() != 2*time.Second {
+		t.Fatalf("RetryInfo = %v, want 2s", retry)
+	}
+}
+
+func TestAcquireQueueTimeout(t *testing.T) {
+	srv := NewFileServiceServer(storage.NewMemoryStorage(),
+		WithLimits(map[string]rpclimit.Limit{"GetFileInfo": {PerClient: 1}}),
+		WithQueue(20*time.Millisecond, 0, 2*time.Second))
+	ctx := context.Background()
+
+	release, err := srv.acquire(ctx, "GetFileInfo", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	stream := &trailerStream{}
+	_, err = srv.acquire(grpc.NewContextWithServerTransportStream(ctx, stream), "GetFileInfo", 0)
+	requireRetryAfter(t, err, stream, "timed out waiting in queue")
+}
+
+func TestAcquireQueueFull(t *testing.T) {
+	srv := NewFileServiceServer(storage.NewMemoryStorage(),
+		WithLimits(map[string]rpclimit.Limit{"GetFileInfo": {PerClient: 1}}),
+		WithQueue(0, 1, 2*time.Second))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release, err := srv.acquire(ctx, "GetFileInfo", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	go srv.acquire(ctx, "GetFileInfo", 0)
+	time.Sleep(20 * time.Millisecond)
+
+	stream := &trailerStream{}
+	probeCtx, cancelProbe := context.WithTimeout(grpc.NewContextWithServerTransportStream(ctx, stream), time.Second)
+	defer cancelProbe()
+	_, err = srv.acquire(probeCtx, "GetFileInfo", 0)
+	requireRetryAfter(t, err, stream, "queue is full")
+}
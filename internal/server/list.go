@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/krekio/TagesTest/internal/storage"
+	pb "github.com/krekio/TagesTest/protos"
+)
+
+const (
+	// DefaultPageSize - размер страницы ListFiles, если клиент его не указал.
+	DefaultPageSize = 1000
+	// MaxPageSize - максимальный размер страницы, большие значения урезаются.
+	MaxPageSize = 10000
+
+	// DefaultBatchSize и MaxBatchSize - то же для сообщений StreamFiles.
+	DefaultBatchSize = 100
+	MaxBatchSize     = 1000
+)
+
+var orderBy = map[pb.ListFilesRequest_OrderBy]storage.OrderBy{
+	pb.ListFilesRequest_NAME:    storage.OrderByName,
+	pb.ListFilesRequest_CREATED: storage.OrderByCreated,
+	pb.ListFilesRequest_UPDATED: storage.OrderByUpdated,
+	pb.ListFilesRequest_SIZE:    storage.OrderBySize,
+}
+
+// listOptions переводит параметры ListFilesRequest в параметры хранилища.
+func listOptions(req *pb.ListFilesRequest) (storage.ListOptions, error) {
+	opts := storage.ListOptions{
+		PageSize:   int(req.PageSize),
+		PageToken:  req.PageToken,
+		Descending: req.Descending,
+		NamePrefix: req.NamePrefix,
+		NameGlob:   req.NameGlob,
+	}
+
+	switch {
+	case req.PageSize < 0:
+		return opts, invalidArgument("page_size", "must not be negative")
+	case req.PageSize == 0:
+		opts.PageSize = DefaultPageSize
+	case req.PageSize > MaxPageSize:
+		opts.PageSize = MaxPageSize
+	}
+
+	order, ok := orderBy[req.OrderBy]
+	if !ok {
+		return opts, invalidArgument("order_by", fmt.Sprintf("unknown value %d", req.OrderBy))
+	}
+	opts.OrderBy = order
+
+	for _, t := range []struct {
+		field string
+		value string
+		dst   *time.Time
+	}{
+		{"created_after", req.CreatedAfter, &opts.CreatedAfter},
+		{"created_before", req.CreatedBefore, &opts.CreatedBefore},
+		{"updated_after", req.UpdatedAfter, &opts.UpdatedAfter},
+		{"updated_before", req.UpdatedBefore, &opts.UpdatedBefore},
+	} {
+		if t.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, t.value)
+		if err != nil {
+			return opts, invalidArgument(t.field, "must be an RFC 3339 timestamp")
+		}
+		*t.dst = parsed
+	}
+
+	return opts, nil
+}
+
+// walkOptions переводит параметры StreamFilesRequest в параметры обхода хранилища.
+func walkOptions(req *pb.StreamFilesRequest) (storage.WalkOptions, error) {
+	opts := storage.WalkOptions{
+		BatchSize:  int(req.BatchSize),
+		NamePrefix: req.NamePrefix,
+		NameGlob:   req.NameGlob,
+	}
+
+	switch {
+	case req.BatchSize < 0:
+		return opts, invalidArgument("batch_size", "must not be negative")
+	case req.BatchSize == 0:
+		opts.BatchSize = DefaultBatchSize
+	case req.BatchSize > MaxBatchSize:
+		opts.BatchSize = MaxBatchSize
+	}
+	return opts, nil
+}
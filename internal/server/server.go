@@ -2,51 +2,237 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"time"
 
+	"github.com/krekio/TagesTest/internal/limiter"
+	"github.com/krekio/TagesTest/internal/rpclimit"
 	"github.com/krekio/TagesTest/internal/storage"
 	pb "github.com/krekio/TagesTest/protos"
-	"golang.org/x/sync/semaphore"
 )
 
+// DefaultRetryAfter - подсказка клиенту, через сколько повторить запрос,
+// отклонённый из-за переполненной очереди.
+const DefaultRetryAfter = time.Second
+
 type FileServiceServer struct {
 	pb.UnimplementedFileServiceServer
-	fileStorage           *storage.FileStorage
-	uploadDownloadLimiter *semaphore.Weighted
-	listLimiter           *semaphore.Weighted
+	fileStorage storage.Backend
+	limiters    map[string]*rpcLimiter
+	retryAfter  time.Duration
+	// trustClientID - считать лимиты по ClientIDHeader, см. WithTrustedClientID.
+	trustClientID bool
+}
+
+type options struct {
+	limits         map[string]rpclimit.Limit
+	maxQueueWait   time.Duration
+	maxQueueLength int
+	retryAfter     time.Duration
+	trustClientID  bool
+}
+
+type Option func(*options)
+
+// WithLimits заменяет таблицу лимитов по умолчанию. Ключ - имя метода
+// FileService из rpclimit.Defaults, например "UploadFile". Методы без записи
+// в таблице не ограничиваются. Паникует на неизвестном имени метода:
+// опечатка в ключе иначе молча сняла бы ограничение.
+func WithLimits(limits map[string]rpclimit.Limit) Option {
+	for method := range limits {
+		if !rpclimit.IsLimited(method) {
+			panic(fmt.Sprintf("server: unknown method %q in limits", method))
+		}
+	}
+	return func(o *options) {
+		o.limits = limits
+	}
+}
+
+// WithQueue ограничивает время ожидания слота и длину очереди клиента.
+// Запросы сверх очереди отклоняются с codes.ResourceExhausted и подсказкой
+// retryAfter в трейлерах ответа.
+func WithQueue(maxWait time.Duration, maxLength int, retryAfter time.Duration) Option {
+	return func(o *options) {
+		o.maxQueueWait = maxWait
+		o.maxQueueLength = maxLength
+		if retryAfter > 0 {
+			o.retryAfter = retryAfter
+		}
+	}
+}
+
+// WithTrustedClientID включает подсчёт лимитов по заголовку ClientIDHeader
+// вместо адреса соединения. Клиент может представиться любым именем и так
+// обойти свой лимит, поэтому включать стоит, только если заголовок
+// выставляет доверенный прокси перед сервером.
+func WithTrustedClientID(trust bool) Option {
+	return func(o *options) {
+		o.trustClientID = trust
+	}
 }
 
-func NewFileServiceServer(storage *storage.FileStorage) *FileServiceServer {
+// NewFileServiceServer создаёт сервер. По умолчанию каждому клиенту разрешено
+// 10 одновременных загрузок, 10 скачиваний, 10 удалений, 100 просмотров
+// списка и 100 запросов сведений о файле.
+func NewFileServiceServer(backend storage.Backend, opts ...Option) *FileServiceServer {
+	o := options{limits: rpclimit.Defaults(), retryAfter: DefaultRetryAfter}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	limiters := make(map[string]*rpcLimiter, len(o.limits))
+	for method, limit := range o.limits {
+		limiters[method] = &rpcLimiter{
+			Limiter: limiter.New(limit.PerClient,
+				limiter.WithGlobalLimit(limit.Global),
+				limiter.WithMaxQueueWait(o.maxQueueWait),
+				limiter.WithMaxQueueLength(o.maxQueueLength),
+			),
+			weightBytes: limit.WeightBytes,
+		}
+	}
+
 	return &FileServiceServer{
-		fileStorage:           storage,
-		uploadDownloadLimiter: semaphore.NewWeighted(10),
-		listLimiter:           semaphore.NewWeighted(100),
+		fileStorage: backend,
+		limiters:    limiters,
+		retryAfter:  o.retryAfter,
+
+		trustClientID: o.trustClientID,
 	}
 }
 
+// UploadFile принимает файл по протоколу v1. Размер в нём не передаётся,
+// поэтому загрузка занимает один слот независимо от WeightBytes;
+// вес по заявленному размеру считает UploadFileV2.
 func (s *FileServiceServer) UploadFile(stream pb.FileService_UploadFileServer) error {
-	if err := s.uploadDownloadLimiter.Acquire(context.Background(), 1); err != nil {
+	release, err := s.acquire(stream.Context(), "UploadFile", 0)
+	if err != nil {
 		return err
 	}
-	defer s.uploadDownloadLimiter.Release(1)
+	defer release()
 
-	return s.fileStorage.Upload(stream)
+	return toStatus(s.upload(stream))
 }
 
 func (s *FileServiceServer) ListFiles(ctx context.Context, req *pb.ListFilesRequest) (*pb.ListFilesResponse, error) {
-	if err := s.listLimiter.Acquire(context.Background(), 1); err != nil {
+	release, err := s.acquire(ctx, "ListFiles", 0)
+	if err != nil {
 		return nil, err
 	}
-	defer s.listLimiter.Release(1)
+	defer release()
 
-	return s.fileStorage.List()
+	opts, err := listOptions(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.fileStorage.List(ctx, opts)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &pb.ListFilesResponse{NextPageToken: res.NextPageToken}
+	for _, f := range res.Files {
+		resp.Files = append(resp.Files, fileInfoProto(f))
+	}
+	return resp, nil
 }
 
 func (s *FileServiceServer) DownloadFile(req *pb.DownloadFileRequest, stream pb.FileService_DownloadFileServer) error {
+	ctx := stream.Context()
+	opts, err := downloadOptions(req)
+	if err != nil {
+		return err
+	}
 
-	if err := s.uploadDownloadLimiter.Acquire(context.Background(), 1); err != nil {
+	// Вес запроса считается по размеру, который узнаётся без чтения файла:
+	// Stat и Open могут досчитывать сумму старых файлов, поэтому они
+	// вызываются только после того, как получен слот. Если файл успеют
+	// перезаписать до Open, вес посчитается по прежней версии.
+	size, err := s.fileStorage.Size(ctx, req.Filename)
+	if err != nil {
+		return toStatus(err)
+	}
+	release, err := s.acquire(ctx, "DownloadFile", size)
+	if err != nil {
 		return err
 	}
-	defer s.uploadDownloadLimiter.Release(1)
+	defer release()
+
+	obj, err := s.fileStorage.Open(ctx, req.Filename)
+	if err != nil {
+		return toStatus(err)
+	}
+	defer obj.Close()
+
+	hashed := newHashingStream(stream)
+	if err := sendFile(obj, opts, hashed); err != nil {
+		return toStatus(err)
+	}
+	hashed.setDigestTrailer()
+	return nil
+}
+
+func (s *FileServiceServer) DeleteFile(ctx context.Context, req *pb.DeleteFileRequest) (*pb.DeleteFileResponse, error) {
+	release, err := s.acquire(ctx, "DeleteFile", 0)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
-	return s.fileStorage.Download(req.Filename, stream)
+	if err := s.fileStorage.Delete(ctx, req.Filename); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.DeleteFileResponse{Message: "Файл успешно удалён"}, nil
+}
+
+func (s *FileServiceServer) GetFileInfo(ctx context.Context, req *pb.GetFileInfoRequest) (*pb.GetFileInfoResponse, error) {
+	release, err := s.acquire(ctx, "GetFileInfo", 0)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	info, err := s.fileStorage.Stat(ctx, req.Filename)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.GetFileInfoResponse{File: fileInfoProto(info)}, nil
+}
+
+// StreamFiles отправляет весь список файлов пачками. Использует лимитер ListFiles.
+func (s *FileServiceServer) StreamFiles(req *pb.StreamFilesRequest, stream pb.FileService_StreamFilesServer) error {
+	ctx := stream.Context()
+	release, err := s.acquire(ctx, "ListFiles", 0)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	opts, err := walkOptions(req)
+	if err != nil {
+		return err
+	}
+
+	return toStatus(s.fileStorage.Walk(ctx, opts, func(files []*storage.FileInfo) error {
+		resp := &pb.StreamFilesResponse{Files: make([]*pb.FileInfo, 0, len(files))}
+		for _, f := range files {
+			resp.Files = append(resp.Files, fileInfoProto(f))
+		}
+		return stream.Send(resp)
+	}))
+}
+
+// fileInfoProto переводит сведения о файле в сообщение API.
+func fileInfoProto(fi *storage.FileInfo) *pb.FileInfo {
+	return &pb.FileInfo{
+		Filename:    fi.Name,
+		CreatedAt:   fi.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   fi.UpdatedAt.Format(time.RFC3339),
+		Size:        fi.Size,
+		Sha256:      fi.SHA256,
+		ContentType: fi.ContentType,
+		Etag:        fi.ETag(),
+	}
 }
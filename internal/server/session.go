@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/krekio/TagesTest/internal/storage"
+	pb "github.com/krekio/TagesTest/protos"
+)
+
+func (s *FileServiceServer) StartUpload(ctx context.Context, req *pb.StartUploadRequest) (*pb.StartUploadResponse, error) {
+	release, err := s.acquire(ctx, "StartUpload", 0)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	policy, err := overwritePolicy(req.Overwrite, req.IfMatch)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := s.fileStorage.StartUpload(ctx, req.Filename, policy, req.IfMatch)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.StartUploadResponse{
+		SessionId: sess.ID,
+		ExpiresAt: sess.ExpiresAt.Format(time.RFC3339),
+	}, nil
+}
+
+// uploadSession дописывает в сессию части из стрима UploadFile. first - уже
+// прочитанное первое сообщение. Идентификатор сессии не должен меняться
+// внутри стрима, а смещение каждой части - совпадать с концом предыдущей.
+func (s *FileServiceServer) uploadSession(stream pb.FileService_UploadFileServer, first *pb.UploadFileRequest) error {
+	id := first.GetSessionId()
+	offset := first.GetOffset()
+	expected := offset
+	next := func() (storage.Chunk, error) {
+		req := first
+		if req != nil {
+			first = nil
+		} else {
+			var err error
+			if req, err = stream.Recv(); err != nil {
+				return storage.Chunk{}, err
+			}
+		}
+		if req.GetSessionId() != id {
+			return storage.Chunk{}, invalidArgument("session_id", "must not change within a stream")
+		}
+		if req.GetOffset() != expected {
+			return storage.Chunk{}, &storage.Error{Kind: storage.ErrOffsetMismatch, Op: "upload", Name: id, Offset: expected}
+		}
+		expected += int64(len(req.GetData()))
+		return storage.Chunk{Data: req.GetData(), CRC32C: req.Crc32C}, nil
+	}
+
+	sess, err := s.fileStorage.WriteUpload(stream.Context(), id, offset, storage.NewChunkReader(id, offset, next))
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(&pb.UploadFileResponse{Message: "Часть файла загружена", CommittedOffset: sess.Offset})
+}
+
+func (s *FileServiceServer) GetUploadStatus(ctx context.Context, req *pb.GetUploadStatusRequest) (*pb.GetUploadStatusResponse, error) {
+	release, err := s.acquire(ctx, "GetUploadStatus", 0)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	sess, err := s.fileStorage.UploadStatus(ctx, req.SessionId)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.GetUploadStatusResponse{
+		SessionId:       sess.ID,
+		Filename:        sess.Name,
+		CommittedOffset: sess.Offset,
+		ExpiresAt:       sess.ExpiresAt.Format(time.RFC3339),
+	}, nil
+}
+
+func (s *FileServiceServer) CommitUpload(ctx context.Context, req *pb.CommitUploadRequest) (*pb.CommitUploadResponse, error) {
+	release, err := s.acquire(ctx, "CommitUpload", 0)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	info, err := s.fileStorage.CommitUpload(ctx, req.SessionId, req.Sha256)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.CommitUploadResponse{File: fileInfoProto(info)}, nil
+}
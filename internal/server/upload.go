@@ -0,0 +1,138 @@
+package server
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/krekio/TagesTest/internal/storage"
+	pb "github.com/krekio/TagesTest/protos"
+)
+
+// upload принимает файл из стрима UploadFile. Если в первом сообщении
+// указан session_id, данные дописываются в сессию возобновляемой загрузки
+// (см. StartUpload). Имя файла берётся из первого сообщения.
+func (s *FileServiceServer) upload(stream pb.FileService_UploadFileServer) error {
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return stream.SendAndClose(&pb.UploadFileResponse{Message: "Файл успешно загружен"})
+	}
+	if err != nil {
+		return err
+	}
+	if first.GetSessionId() != "" {
+		return s.uploadSession(stream, first)
+	}
+
+	hdr := storage.UploadHeader{Name: first.GetFilename(), Size: -1, SHA256: first.GetSha256()}
+	next := func() (storage.Chunk, error) {
+		var req *pb.UploadFileRequest
+		if first != nil {
+			req, first = first, nil
+		} else if req, err = stream.Recv(); err != nil {
+			return storage.Chunk{}, err
+		}
+		return storage.Chunk{Data: req.GetData(), CRC32C: req.Crc32C}, nil
+	}
+
+	info, err := s.fileStorage.Put(stream.Context(), hdr, storage.NewChunkReader(hdr.Name, 0, next))
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(uploadResponse(info))
+}
+
+// UploadFileV2 принимает файл, описанный заголовком в первом сообщении.
+// Заголовок обязателен и передаётся ровно один раз, дальше идут только части.
+func (s *FileServiceServer) UploadFileV2(stream pb.FileService_UploadFileV2Server) error {
+	ctx := stream.Context()
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return invalidArgument("header", "stream must start with an upload header")
+	}
+	if err != nil {
+		return toStatus(err)
+	}
+	header := first.GetHeader()
+	if header == nil {
+		return invalidArgument("header", "stream must start with an upload header")
+	}
+
+	hdr, err := uploadHeader(header)
+	if err != nil {
+		return err
+	}
+
+	// Заголовок читается до лимитера, чтобы вес загрузки считался
+	// по заявленному размеру.
+	release, err := s.acquire(ctx, "UploadFile", max(hdr.Size, 0))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	next := func() (storage.Chunk, error) {
+		req, err := stream.Recv()
+		if err != nil {
+			return storage.Chunk{}, err
+		}
+		if _, ok := req.Payload.(*pb.UploadFileV2Request_Chunk); !ok {
+			return storage.Chunk{}, invalidArgument("header", "upload header must be sent exactly once, before any chunk")
+		}
+		return storage.Chunk{Data: req.GetChunk(), CRC32C: req.Crc32C}, nil
+	}
+
+	info, err := s.fileStorage.Put(ctx, hdr, storage.NewChunkReader(hdr.Name, 0, next))
+	if err != nil {
+		return toStatus(err)
+	}
+	return stream.SendAndClose(uploadResponse(info))
+}
+
+func uploadResponse(info *storage.FileInfo) *pb.UploadFileResponse {
+	return &pb.UploadFileResponse{
+		Message:  "Файл успешно загружен",
+		Sha256:   info.SHA256,
+		Filename: info.Name,
+		Etag:     info.ETag(),
+	}
+}
+
+// uploadHeader проверяет заголовок загрузки и переводит его в параметры хранилища.
+func uploadHeader(h *pb.UploadHeader) (storage.UploadHeader, error) {
+	hdr := storage.UploadHeader{
+		Name:        h.Filename,
+		Size:        -1,
+		ContentType: h.ContentType,
+		SHA256:      h.Sha256,
+	}
+	if h.Size != nil {
+		if h.GetSize() < 0 {
+			return hdr, invalidArgument("header.size", "must not be negative")
+		}
+		hdr.Size = h.GetSize()
+	}
+	policy, err := overwritePolicy(h.Overwrite, h.IfMatch)
+	if err != nil {
+		return hdr, err
+	}
+	hdr.Overwrite, hdr.IfMatch = policy, h.IfMatch
+	return hdr, nil
+}
+
+var overwritePolicies = map[pb.UploadHeader_OverwritePolicy]storage.OverwritePolicy{
+	pb.UploadHeader_OVERWRITE:      storage.Overwrite,
+	pb.UploadHeader_FAIL_IF_EXISTS: storage.FailIfExists,
+	pb.UploadHeader_AUTO_RENAME:    storage.AutoRename,
+	pb.UploadHeader_IF_MATCH:       storage.IfMatch,
+}
+
+func overwritePolicy(p pb.UploadHeader_OverwritePolicy, ifMatch string) (storage.OverwritePolicy, error) {
+	policy, ok := overwritePolicies[p]
+	if !ok {
+		return 0, invalidArgument("overwrite", fmt.Sprintf("unknown policy %d", p))
+	}
+	if policy == storage.IfMatch && ifMatch == "" {
+		return 0, invalidArgument("if_match", "must be set for the IF_MATCH policy")
+	}
+	return policy, nil
+}
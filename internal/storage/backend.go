@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// Backend - хранилище файлов, не зависящее от транспорта. Данные
+// передаются через io.Reader и Object, ошибки с понятной клиенту причиной
+// возвращаются как *Error с одним из видов Err*.
+type Backend interface {
+	// Put сохраняет файл с содержимым из r, см. UploadHeader.
+	Put(ctx context.Context, hdr UploadHeader, r io.Reader) (*FileInfo, error)
+	// Open открывает файл для чтения.
+	Open(ctx context.Context, name string) (Object, error)
+	Stat(ctx context.Context, name string) (*FileInfo, error)
+	// Size возвращает размер файла, не читая содержимое: в отличие от Stat,
+	// сумма файлов, загруженных до её появления, не досчитывается.
+	Size(ctx context.Context, name string) (int64, error)
+	Delete(ctx context.Context, name string) error
+	List(ctx context.Context, opts ListOptions) (*ListResult, error)
+	Walk(ctx context.Context, opts WalkOptions, fn func([]*FileInfo) error) error
+
+	// StartUpload, WriteUpload и CommitUpload - возобновляемая загрузка:
+	// данные дописываются в сессию частями и публикуются одним вызовом.
+	StartUpload(ctx context.Context, name string, policy OverwritePolicy, ifMatch string) (*UploadSession, error)
+	UploadStatus(ctx context.Context, id string) (*UploadSession, error)
+	// WriteUpload дописывает в сессию данные из r, начиная со смещения
+	// offset, которое должно совпадать с UploadSession.Offset. Данные,
+	// полученные до ошибки чтения r, сохраняются в сессии.
+	WriteUpload(ctx context.Context, id string, offset int64, r io.Reader) (*UploadSession, error)
+	CommitUpload(ctx context.Context, id, expectedSHA256 string) (*FileInfo, error)
+}
+
+// Object - открытая для чтения версия файла. Info описывает именно её,
+// даже если файл заменили после открытия.
+type Object interface {
+	io.ReaderAt
+	io.Closer
+	Info() *FileInfo
+}
+
+var _ Backend = (*FileStorage)(nil)
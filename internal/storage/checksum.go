@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// checkChunk сверяет CRC32C части, если клиент его передал.
+func checkChunk(name string, offset int64, chunk Chunk) error {
+	if chunk.CRC32C == nil {
+		return nil
+	}
+	if got := crc32.Checksum(chunk.Data, castagnoli); got != *chunk.CRC32C {
+		return &Error{Kind: ErrChecksumMismatch, Op: "upload", Name: name, Field: "crc32c",
+			Reason: fmt.Sprintf("chunk at offset %d: expected %08x, got %08x", offset, *chunk.CRC32C, got)}
+	}
+	return nil
+}
+
+// chunkReader собирает поток из частей и сверяет CRC32C каждой части
+// до того, как отдать из неё хоть один байт.
+type chunkReader struct {
+	name   string
+	offset int64
+	next   func() (Chunk, error)
+	buf    []byte
+	err    error
+}
+
+// NewChunkReader возвращает поток из частей, которые возвращает next;
+// конец файла обозначается io.EOF. offset - смещение первой части в файле,
+// нужно только для сообщений об ошибках.
+func NewChunkReader(name string, offset int64, next func() (Chunk, error)) io.Reader {
+	return &chunkReader{name: name, offset: offset, next: next}
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		chunk, err := r.next()
+		if err == nil {
+			err = checkChunk(r.name, r.offset, chunk)
+		}
+		if err != nil {
+			r.err = err
+			return 0, err
+		}
+		r.buf = chunk.Data
+		r.offset += int64(len(chunk.Data))
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// checkDigest сверяет SHA-256 файла с заявленным клиентом, если он есть.
+func checkDigest(name, expected, actual string) error {
+	if expected == "" || strings.EqualFold(expected, actual) {
+		return nil
+	}
+	return &Error{Kind: ErrChecksumMismatch, Op: "upload", Name: name, Field: "sha256",
+		Reason: fmt.Sprintf("expected %s, got %s", strings.ToLower(expected), actual)}
+}
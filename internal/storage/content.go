@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+)
+
+// sniffLen - сколько байт из начала файла нужно http.DetectContentType.
+const sniffLen = 512
+
+// contentInfo - сведения о содержимом файла, которые считаются при записи.
+type contentInfo struct {
+	Size        int64
+	SHA256      string
+	ContentType string
+}
+
+// digester считает размер, SHA-256 и тип содержимого по мере записи,
+// чтобы не перечитывать файл после загрузки.
+type digester struct {
+	hash hash.Hash
+	head []byte
+	size int64
+}
+
+func newDigester() *digester {
+	return &digester{hash: sha256.New()}
+}
+
+func (d *digester) Write(p []byte) (int, error) {
+	if rest := sniffLen - len(d.head); rest > 0 {
+		d.head = append(d.head, p[:min(rest, len(p))]...)
+	}
+	d.hash.Write(p)
+	d.size += int64(len(p))
+	return len(p), nil
+}
+
+func (d *digester) info() contentInfo {
+	return contentInfo{
+		Size:        d.size,
+		SHA256:      hex.EncodeToString(d.hash.Sum(nil)),
+		ContentType: http.DetectContentType(d.head),
+	}
+}
+
+// digest читает r целиком и возвращает сведения о содержимом.
+func digest(r io.Reader) (contentInfo, error) {
+	d := newDigester()
+	if _, err := io.Copy(d, r); err != nil {
+		return contentInfo{}, err
+	}
+	return d.info(), nil
+}
@@ -0,0 +1,395 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Каталоги раскладки DedupStorage.
+const (
+	// objectsDir - содержимое файлов по SHA-256: objects/ab/cd/<sha256>.
+	objectsDir = "objects"
+	// refsDir - индекс имён: для каждого файла <name>.json со ссылкой
+	// на содержимое и метаданными, как в metaDir.
+	refsDir = ".refs"
+)
+
+// DedupStorage хранит содержимое каждого уникального файла один раз,
+// а имена файлов - ссылками на него в индексе. Одинаковые файлы под
+// разными именами занимают место один раз: квота учитывает объём
+// содержимого, а не сумму размеров файлов. Пока файл загружается, он
+// занимает место в квоте, даже если такое содержимое уже есть: это
+// становится известно только после получения всех данных.
+//
+// На каждое содержимое считается число ссылок. Оно не хранится, а
+// восстанавливается по индексу при запуске, поэтому не может разойтись
+// с индексом после сбоя. Содержимое удаляется вместе с последней ссылкой;
+// оставшееся без ссылок после сбоя удаляется при запуске.
+//
+// Временные файлы и сессии загрузки устроены так же, как в FileStorage.
+type DedupStorage struct {
+	*FileStorage
+	// refs - число имён, ссылающихся на содержимое с данной суммой.
+	// Защищено metaMu.
+	refs map[string]int
+}
+
+var _ Backend = (*DedupStorage)(nil)
+
+func NewDedupStorage(path string, opts ...Option) (*DedupStorage, error) {
+	// Файлы других раскладок оказались бы невидимыми, а новые легли бы рядом.
+	other, err := containsEntry(path, func(e os.DirEntry) bool { return isFlatFile(e) || isShard(e) })
+	if err != nil {
+		return nil, err
+	}
+	if other {
+		return nil, fmt.Errorf("storage directory %s uses the flat or sharded layout, set storage.layout to match it", path)
+	}
+
+	for _, dir := range []string{refsDir, objectsDir, uploadsDir} {
+		if err := os.MkdirAll(filepath.Join(path, dir), os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	if err := removeTemp(path, filepath.Join(path, refsDir), filepath.Join(path, uploadsDir)); err != nil {
+		return nil, err
+	}
+
+	s := &DedupStorage{FileStorage: &FileStorage{storagePath: path}}
+	s.init(opts)
+	s.publish = s.commit
+	if err := s.removeExpiredSessions(); err != nil {
+		return nil, err
+	}
+	// Части незавершённых загрузок, содержимое добавляется в loadRefs.
+	if err := s.scanUsage(); err != nil {
+		return nil, err
+	}
+	if err := s.loadRefs(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// isDedupDir сообщает, является ли запись корня каталогом раскладки DedupStorage.
+func isDedupDir(e os.DirEntry) bool {
+	return e.IsDir() && (e.Name() == objectsDir || e.Name() == refsDir)
+}
+
+// refuseDedup не даёт открыть каталог раскладки DedupStorage как FileStorage.
+func refuseDedup(path string) error {
+	dedup, err := containsEntry(path, isDedupDir)
+	if err != nil {
+		return err
+	}
+	if dedup {
+		return fmt.Errorf("storage directory %s uses the dedup layout, set storage.layout to dedup", path)
+	}
+	return nil
+}
+
+func (s *DedupStorage) refPath(name string) string {
+	return filepath.Join(s.storagePath, refsDir, name+".json")
+}
+
+// objectPath - путь содержимого с суммой sum. Два уровня каталогов по
+// первым символам суммы не дают одному каталогу разрастись.
+func (s *DedupStorage) objectPath(sum string) string {
+	return filepath.Join(s.storagePath, objectsDir, sum[:2], sum[2:4], sum)
+}
+
+func (s *DedupStorage) readRef(name string) (*fileMeta, error) {
+	data, err := os.ReadFile(s.refPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ref fileMeta
+	if err := json.Unmarshal(data, &ref); err != nil {
+		return nil, err
+	}
+	if !validSHA256(ref.SHA256) {
+		return nil, errors.New("invalid content reference in " + s.refPath(name))
+	}
+	return &ref, nil
+}
+
+func validSHA256(sum string) bool {
+	return len(sum) == 64 && strings.Trim(sum, "0123456789abcdef") == ""
+}
+
+func refInfo(name string, ref *fileMeta) *FileInfo {
+	return &FileInfo{
+		Name:        name,
+		Size:        ref.Size,
+		SHA256:      ref.SHA256,
+		ContentType: ref.ContentType,
+		CreatedAt:   ref.CreatedAt,
+		UpdatedAt:   ref.UpdatedAt,
+	}
+}
+
+// info возвращает сведения о файле из индекса.
+func (s *DedupStorage) info(name string) (*FileInfo, error) {
+	ref, err := s.readRef(name)
+	if err != nil {
+		return nil, err
+	}
+	if ref == nil {
+		return nil, &Error{Kind: ErrNotFound, Op: "stat", Name: name}
+	}
+	return refInfo(name, ref), nil
+}
+
+// commit публикует временный файл под именем name с учётом политики
+// перезаписи. Если такое содержимое уже есть, временный файл удаляется,
+// а место, которое он занимал, освобождается.
+func (s *DedupStorage) commit(tmpPath, name string, content contentInfo, policy OverwritePolicy, ifMatch string) (*FileInfo, error) {
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+
+	var old *fileMeta
+	current := func(candidate string) error {
+		var err error
+		old, err = s.readRef(candidate)
+		return err
+	}
+	free := func(candidate string) error {
+		if err := current(candidate); err != nil {
+			return err
+		}
+		if old != nil {
+			return &Error{Kind: ErrAlreadyExists, Op: "upload", Name: candidate}
+		}
+		return nil
+	}
+
+	switch policy {
+	case Overwrite:
+		if err := current(name); err != nil {
+			return nil, err
+		}
+	case FailIfExists:
+		if err := free(name); err != nil {
+			return nil, err
+		}
+	case AutoRename:
+		var err error
+		if name, err = s.firstFree(name, free); err != nil {
+			return nil, err
+		}
+	case IfMatch:
+		if err := current(name); err != nil {
+			return nil, err
+		}
+		if old == nil {
+			return nil, noCurrentVersion(name)
+		}
+		if err := checkIfMatch(name, ifMatch, old.SHA256); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, unknownPolicy(name, policy)
+	}
+
+	// Сначала содержимое, потом ссылка: после сбоя между ними остаётся
+	// содержимое без ссылок, которое удаляется при запуске.
+	duplicate := s.refs[content.SHA256] > 0
+	if !duplicate {
+		if err := s.storeObject(tmpPath, content.SHA256); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	ref := &fileMeta{CreatedAt: now, UpdatedAt: now, Size: content.Size, SHA256: content.SHA256, ContentType: content.ContentType}
+	if old != nil {
+		ref.CreatedAt = old.CreatedAt
+	}
+	if err := s.writeRef(name, ref); err != nil {
+		if !duplicate {
+			os.Remove(s.objectPath(content.SHA256))
+		}
+		return nil, err
+	}
+	s.refs[content.SHA256]++
+
+	if duplicate {
+		os.Remove(tmpPath)
+		s.release(content.Size)
+	}
+	if old != nil {
+		s.unref(old)
+	}
+	info, err := s.info(name)
+	return info, afterPublish(err)
+}
+
+func (s *DedupStorage) storeObject(tmpPath, sum string) error {
+	path := s.objectPath(sum)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+func (s *DedupStorage) writeRef(name string, ref *fileMeta) error {
+	data, err := json.Marshal(ref)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.refPath(name), data)
+}
+
+// unref снимает ссылку на содержимое и удаляет его, если ссылка была
+// последней. Вызывается под s.metaMu.
+func (s *DedupStorage) unref(ref *fileMeta) {
+	s.refs[ref.SHA256]--
+	if s.refs[ref.SHA256] > 0 {
+		return
+	}
+	delete(s.refs, ref.SHA256)
+	if err := os.Remove(s.objectPath(ref.SHA256)); err == nil || errors.Is(err, os.ErrNotExist) {
+		s.release(ref.Size)
+	}
+}
+
+// Open открывает файл для чтения. Содержимое по сумме не меняется,
+// поэтому открытая версия остаётся согласованной со сведениями о ней,
+// даже если имя потом перезапишут.
+func (s *DedupStorage) Open(ctx context.Context, name string) (Object, error) {
+	if err := s.names.Validate(name); err != nil {
+		return nil, err
+	}
+
+	s.metaMu.RLock()
+	defer s.metaMu.RUnlock()
+
+	ref, err := s.readRef(name)
+	if err != nil {
+		return nil, err
+	}
+	if ref == nil {
+		return nil, &Error{Kind: ErrNotFound, Op: "download", Name: name}
+	}
+	file, err := os.Open(s.objectPath(ref.SHA256))
+	if err != nil {
+		return nil, err
+	}
+	return &fileObject{File: file, info: refInfo(name, ref)}, nil
+}
+
+// Stat возвращает сведения о файле.
+func (s *DedupStorage) Stat(ctx context.Context, name string) (*FileInfo, error) {
+	if err := s.names.Validate(name); err != nil {
+		return nil, err
+	}
+	return s.info(name)
+}
+
+// Size возвращает размер файла из ссылки на содержимое.
+func (s *DedupStorage) Size(ctx context.Context, name string) (int64, error) {
+	info, err := s.Stat(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+// Delete удаляет имя файла, а содержимое - если на него больше нет ссылок.
+func (s *DedupStorage) Delete(ctx context.Context, name string) error {
+	if err := s.names.Validate(name); err != nil {
+		return err
+	}
+
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+
+	ref, err := s.readRef(name)
+	if err != nil {
+		return err
+	}
+	if ref == nil {
+		return &Error{Kind: ErrNotFound, Op: "delete", Name: name}
+	}
+	if err := os.Remove(s.refPath(name)); err != nil {
+		return err
+	}
+	s.unref(ref)
+	return nil
+}
+
+// index - индекс имён, одна запись <name>.json на файл.
+func (s *DedupStorage) index() dirIndex {
+	return dirIndex{
+		dir: filepath.Join(s.storagePath, refsDir),
+		name: func(e os.DirEntry) (string, bool) {
+			name, ok := strings.CutSuffix(e.Name(), ".json")
+			return name, ok && e.Type().IsRegular() && !isTemp(e.Name())
+		},
+		info:      s.info,
+		checkSort: s.checkSortLimit,
+	}
+}
+
+// List возвращает страницу файлов, см. FileStorage.List.
+func (s *DedupStorage) List(ctx context.Context, opts ListOptions) (*ListResult, error) {
+	return s.index().list(opts)
+}
+
+// Walk обходит индекс имён, см. FileStorage.Walk.
+func (s *DedupStorage) Walk(ctx context.Context, opts WalkOptions, fn func([]*FileInfo) error) error {
+	return s.index().walk(ctx, opts, fn)
+}
+
+// loadRefs считает ссылки по индексу, удаляет содержимое без ссылок
+// и добавляет объём оставшегося к занятому месту.
+func (s *DedupStorage) loadRefs() error {
+	refs := make(map[string]int)
+	err := s.index().walk(context.Background(), WalkOptions{BatchSize: 1000}, func(files []*FileInfo) error {
+		for _, f := range files {
+			refs[f.SHA256]++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var used int64
+	err = filepath.WalkDir(filepath.Join(s.storagePath, objectsDir), func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if refs[d.Name()] == 0 {
+			return os.Remove(path)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		used += info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.refs = refs
+	s.usageMu.Lock()
+	s.used += used
+	s.usageMu.Unlock()
+	return nil
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Виды ошибок хранилища. Проверяются через errors.Is, сервер по ним
+// выбирает код ответа gRPC.
+var (
+	ErrNotFound       = errors.New("file not found")
+	ErrAlreadyExists  = errors.New("file already exists")
+	ErrInvalidName    = errors.New("invalid filename")
+	ErrInvalidArg     = errors.New("invalid argument")
+	ErrInvalidContent = errors.New("invalid file content")
+	ErrQuotaExceeded  = errors.New("storage quota exceeded")
+	ErrTooLarge       = errors.New("file too large")
+	ErrOutOfRange     = errors.New("range out of file bounds")
+
+	ErrChecksumMismatch   = errors.New("checksum mismatch")
+	ErrPreconditionFailed = errors.New("precondition failed")
+
+	ErrSessionNotFound = errors.New("upload session not found")
+	ErrSessionBusy     = errors.New("upload session is in use")
+	ErrOffsetMismatch  = errors.New("unexpected upload offset")
+)
+
+// Error - ошибка операции над конкретным файлом.
+type Error struct {
+	// Kind - один из Err* выше.
+	Kind error
+	Op   string
+	Name string
+	// Reason уточняет причину, например какое правило имени нарушено.
+	Reason string
+	// Field - параметр запроса с некорректным значением для ErrInvalidArg,
+	// ErrInvalidContent, ErrOutOfRange, ErrChecksumMismatch и ErrPreconditionFailed.
+	Field string
+	// Limit - превышенный лимит в байтах для ErrQuotaExceeded и ErrTooLarge,
+	// размер файла для ErrOutOfRange.
+	Limit int64
+	// Offset - ожидаемое смещение для ErrOffsetMismatch.
+	Offset int64
+	// Err - исходная ошибка, если есть.
+	Err error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s %q: %v", e.Op, e.Name, e.Kind)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
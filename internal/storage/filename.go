@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMaxNameLength - максимальная длина имени файла в байтах. Оставляет
+// запас под суффикс файла метаданных в пределах NAME_MAX (255) большинства ФС.
+const DefaultMaxNameLength = 200
+
+// reservedNames - имена, которые нельзя использовать на Windows и которые
+// ломают переносимость хранилища.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// NamePolicy описывает допустимые имена файлов в хранилище.
+type NamePolicy struct {
+	// MaxLength - максимальная длина имени в байтах.
+	MaxLength int
+	// Charset, если задан, должен совпадать с именем целиком.
+	Charset *regexp.Regexp
+}
+
+func DefaultNamePolicy() NamePolicy {
+	return NamePolicy{MaxLength: DefaultMaxNameLength}
+}
+
+// Validate проверяет, что имя можно безопасно использовать как имя файла
+// в плоском каталоге хранилища.
+func (p NamePolicy) Validate(name string) error {
+	invalid := func(reason string) error {
+		return &Error{Kind: ErrInvalidName, Op: "validate", Name: name, Reason: reason}
+	}
+
+	if name == "" {
+		return invalid("must not be empty")
+	}
+	if p.MaxLength > 0 && len(name) > p.MaxLength {
+		return invalid(fmt.Sprintf("must be at most %d bytes", p.MaxLength))
+	}
+	if !utf8.ValidString(name) {
+		return invalid("must be valid UTF-8")
+	}
+	if name == "." || name == ".." {
+		return invalid("must not be a relative path element")
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return invalid("must not contain path separators")
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f {
+			return invalid("must not contain NUL or control characters")
+		}
+	}
+	// Имена с точкой в начале зарезервированы под служебные файлы
+	// хранилища (метаданные, временные файлы загрузок).
+	if strings.HasPrefix(name, ".") {
+		return invalid("must not start with a dot")
+	}
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		return invalid("must not end with a dot or space")
+	}
+	base, _, _ := strings.Cut(name, ".")
+	if reservedNames[strings.ToUpper(base)] {
+		return invalid("is a reserved name")
+	}
+	if p.Charset != nil && !p.Charset.MatchString(name) {
+		return invalid(fmt.Sprintf("must match %s", p.Charset))
+	}
+	return nil
+}
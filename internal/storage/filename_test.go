@@ -0,0 +1,72 @@
+package storage_test
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/krekio/TagesTest/internal/storage"
+)
+
+func TestNamePolicyValidate(t *testing.T) {
+	charset := regexp.MustCompile(`^[a-z0-9._-]+$`)
+	tests := []struct {
+		name   string
+		policy storage.NamePolicy
+		file   string
+		valid  bool
+	}{
+		{"plain", storage.DefaultNamePolicy(), "photo.png", true},
+		{"unicode", storage.DefaultNamePolicy(), "фото 1.png", true},
+		{"dots inside", storage.DefaultNamePolicy(), "a..b.png", true},
+		{"empty", storage.DefaultNamePolicy(), "", false},
+
+		{"dot", storage.DefaultNamePolicy(), ".", false},
+		{"dot dot", storage.DefaultNamePolicy(), "..", false},
+		{"traversal", storage.DefaultNamePolicy(), "../etc/passwd", false},
+		{"nested traversal", storage.DefaultNamePolicy(), "a/../../b", false},
+		{"windows traversal", storage.DefaultNamePolicy(), `..\boot.ini`, false},
+		{"absolute", storage.DefaultNamePolicy(), "/etc/passwd", false},
+		{"absolute windows", storage.DefaultNamePolicy(), `C:\Windows\win.ini`, false},
+		{"subdirectory", storage.DefaultNamePolicy(), "dir/file.png", false},
+
+		{"NUL", storage.DefaultNamePolicy(), "a\x00.png", false},
+		{"newline", storage.DefaultNamePolicy(), "a\n.png", false},
+		{"escape", storage.DefaultNamePolicy(), "a\x1b[31m.png", false},
+		{"DEL", storage.DefaultNamePolicy(), "a\x7f.png", false},
+		{"invalid UTF-8", storage.DefaultNamePolicy(), "a\xff.png", false},
+
+		{"hidden", storage.DefaultNamePolicy(), ".meta", false},
+		{"trailing dot", storage.DefaultNamePolicy(), "file.", false},
+		{"trailing space", storage.DefaultNamePolicy(), "file ", false},
+		{"reserved", storage.DefaultNamePolicy(), "CON", false},
+		{"reserved lower case", storage.DefaultNamePolicy(), "nul.txt", false},
+		{"reserved with extension", storage.DefaultNamePolicy(), "LPT1.tar.gz", false},
+		{"reserved prefix only", storage.DefaultNamePolicy(), "CONSOLE.txt", true},
+
+		{"at length limit", storage.DefaultNamePolicy(), strings.Repeat("a", storage.DefaultMaxNameLength), true},
+		{"over length limit", storage.DefaultNamePolicy(), strings.Repeat("a", storage.DefaultMaxNameLength+1), false},
+		{"limit in bytes", storage.NamePolicy{MaxLength: 3}, "яя", false},
+		{"custom limit", storage.NamePolicy{MaxLength: 5}, "a.png", true},
+		{"no limit", storage.NamePolicy{}, strings.Repeat("a", 1000), true},
+
+		{"charset match", storage.NamePolicy{Charset: charset}, "photo-1.png", true},
+		{"charset mismatch", storage.NamePolicy{Charset: charset}, "Photo.png", false},
+		{"charset keeps base rules", storage.NamePolicy{Charset: regexp.MustCompile(`^.*$`)}, "..", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.file)
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("Validate(%q) = %v, want nil", tt.file, err)
+				}
+				return
+			}
+			if !errors.Is(err, storage.ErrInvalidName) {
+				t.Fatalf("Validate(%q) = %v, want %v", tt.file, err, storage.ErrInvalidName)
+			}
+		})
+	}
+}
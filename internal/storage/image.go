@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/webp"
+)
+
+// ImageFormats - форматы изображений, которые умеет проверять хранилище,
+// в терминах image.DecodeConfig.
+var ImageFormats = []string{"png", "jpeg", "gif", "bmp", "webp"}
+
+// imageExtensions - допустимые расширения имени файла для каждого формата.
+var imageExtensions = map[string][]string{
+	"png":  {".png"},
+	"jpeg": {".jpg", ".jpeg", ".jpe"},
+	"gif":  {".gif"},
+	"bmp":  {".bmp"},
+	"webp": {".webp"},
+}
+
+// imageSniffWindow - сколько байт из начала файла может понадобиться для
+// разбора заголовка. У JPEG перед размерами кадра могут идти EXIF и миниатюра.
+const imageSniffWindow = 64 << 10
+
+// ContentPolicy описывает допустимое содержимое файлов.
+type ContentPolicy struct {
+	// ImageFormats - разрешённые форматы изображений из ImageFormats.
+	// Пустой список отключает проверку содержимого.
+	ImageFormats []string
+}
+
+// WithContentPolicy включает проверку содержимого загружаемых файлов.
+func WithContentPolicy(p ContentPolicy) Option {
+	return func(b *base) {
+		b.content = p
+	}
+}
+
+func (p ContentPolicy) enabled() bool {
+	return len(p.ImageFormats) > 0
+}
+
+// imageSniffer проверяет по началу потока, что загружается изображение
+// разрешённого формата, совпадающего с расширением имени файла.
+// Проверка выполняется, как только заголовок изображения разобран,
+// поэтому неподходящая загрузка отклоняется на первых частях.
+type imageSniffer struct {
+	policy ContentPolicy
+	name   string
+	// declared - MIME-тип, заявленный клиентом, если есть.
+	declared string
+	head     []byte
+	// checked - длина head при последней неудавшейся попытке разбора.
+	checked int
+	done    bool
+	// contentType - определённый тип содержимого после успешной проверки.
+	contentType string
+}
+
+func (v *imageSniffer) Write(p []byte) (int, error) {
+	if v.done {
+		return len(p), nil
+	}
+	if rest := imageSniffWindow - len(v.head); rest > 0 {
+		v.head = append(v.head, p[:min(rest, len(p))]...)
+	}
+	full := len(v.head) >= imageSniffWindow
+	// Каждая попытка разбирает начало файла заново, поэтому при мелких
+	// частях повторяем её, только когда начало выросло вдвое.
+	if !full && len(v.head) < 2*v.checked {
+		return len(p), nil
+	}
+	if err := v.check(full); err != nil {
+		return 0, err
+	}
+	if !v.done {
+		v.checked = len(v.head)
+	}
+	return len(p), nil
+}
+
+// finish завершает проверку в конце загрузки, когда больше данных не будет.
+func (v *imageSniffer) finish() error {
+	if v.done {
+		return nil
+	}
+	return v.check(true)
+}
+
+// check проверяет накопленное начало файла. Пока заголовок изображения
+// обрезан и данных может прийти больше (final = false), решение откладывается.
+func (v *imageSniffer) check(final bool) error {
+	invalid := func(format string, args ...any) error {
+		return &Error{Kind: ErrInvalidContent, Op: "upload", Name: v.name, Field: "data", Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if len(v.head) == 0 {
+		if final {
+			return invalid("file is empty, expected an image")
+		}
+		return nil
+	}
+
+	_, format, err := image.DecodeConfig(bytes.NewReader(v.head))
+	if err != nil && !final {
+		// Заголовок ещё не пришёл целиком. При слишком коротком начале
+		// файла не распознаётся даже сигнатура формата.
+		truncated := errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+		if truncated || (errors.Is(err, image.ErrFormat) && len(v.head) < sniffLen) {
+			return nil
+		}
+	}
+	if ct := http.DetectContentType(v.head); !strings.HasPrefix(ct, "image/") {
+		return invalid("content is not an image (detected %s)", ct)
+	}
+	if err != nil {
+		return invalid("cannot decode image header: %v", err)
+	}
+
+	if !slices.Contains(v.policy.ImageFormats, format) {
+		return invalid("image format %s is not allowed", format)
+	}
+	ext := strings.ToLower(filepath.Ext(v.name))
+	if !slices.Contains(imageExtensions[format], ext) {
+		return invalid("extension %q does not match %s content", ext, format)
+	}
+	v.contentType = "image/" + format
+	if v.declared != "" && !strings.EqualFold(v.declared, v.contentType) {
+		return invalid("declared content type %s does not match %s content", v.declared, format)
+	}
+
+	v.done = true
+	return nil
+}
+
+// checkImageFile проверяет содержимое уже записанного файла и возвращает
+// его MIME-тип.
+func checkImageFile(policy ContentPolicy, name string, r io.Reader) (string, error) {
+	head, err := io.ReadAll(io.LimitReader(r, imageSniffWindow))
+	if err != nil {
+		return "", err
+	}
+	v := &imageSniffer{policy: policy, name: name, head: head}
+	if err := v.check(true); err != nil {
+		return "", err
+	}
+	return v.contentType, nil
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// FileInfo - сведения о сохранённом файле.
+type FileInfo struct {
+	Name        string
+	Size        int64
+	SHA256      string
+	ContentType string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// ETag возвращает строгий ETag файла - SHA-256 содержимого в hex.
+// Пустой, если сумма ещё не посчитана.
+func (fi *FileInfo) ETag() string {
+	return fi.SHA256
+}
+
+// matchETag сравнивает ETag из запроса с ETag файла. Допускает кавычки
+// вокруг значения, как в HTTP, и "*" для любого существующего файла.
+func matchETag(want, etag string) bool {
+	want = strings.Trim(strings.TrimSpace(want), `"`)
+	if want == "*" {
+		return true
+	}
+	return etag != "" && strings.EqualFold(want, etag)
+}
+
+// Stat возвращает сведения о файле. Для файлов, загруженных до появления
+// контрольных сумм в метаданных, содержимое читается один раз, а результат
+// сохраняется в метаданные.
+func (s *FileStorage) Stat(ctx context.Context, filename string) (*FileInfo, error) {
+	if err := s.names.Validate(filename); err != nil {
+		return nil, err
+	}
+
+	info, err := s.info(filename)
+	if err != nil {
+		return nil, err
+	}
+	if info.SHA256 != "" {
+		return info, nil
+	}
+
+	file, info, err := s.open("stat", filename)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	return info, nil
+}
+
+// Size возвращает размер файла без чтения содержимого и метаданных.
+func (s *FileStorage) Size(ctx context.Context, filename string) (int64, error) {
+	if err := s.names.Validate(filename); err != nil {
+		return 0, err
+	}
+	stat, err := os.Stat(s.filePath(filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, &Error{Kind: ErrNotFound, Op: "stat", Name: filename}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+// fillDigest считает сумму и тип открытого файла, загруженного до появления
+// сумм в метаданных, и сохраняет их в метаданные, чтобы следующие Stat
+// и Open не читали файл заново. Файл читается без блокировки, а сумма
+// сохраняется, только если за это время файл не заменили.
+func (s *FileStorage) fillDigest(file *os.File, info *FileInfo) error {
+	opened, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	// Чтение по смещениям не сдвигает позицию файла, который потом отдаётся.
+	content, err := digest(io.NewSectionReader(file, 0, opened.Size()))
+	if err != nil {
+		return err
+	}
+	info.Size, info.SHA256, info.ContentType = content.Size, content.SHA256, content.ContentType
+
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+
+	current, err := os.Stat(s.filePath(info.Name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(opened, current) || current.Size() != content.Size {
+		return nil
+	}
+	return s.writeMeta(info.Name, &fileMeta{
+		CreatedAt:   info.CreatedAt,
+		UpdatedAt:   info.UpdatedAt,
+		Size:        content.Size,
+		SHA256:      content.SHA256,
+		ContentType: content.ContentType,
+	})
+}
+
+// info собирает сведения о файле из файловой системы и метаданных без
+// чтения содержимого. Контрольная сумма и тип заполняются, только если они
+// есть в метаданных и соответствуют текущему размеру файла.
+func (s *FileStorage) info(name string) (*FileInfo, error) {
+	stat, err := os.Stat(s.filePath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, &Error{Kind: ErrNotFound, Op: "stat", Name: name}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.infoFromStat(name, stat)
+}
+
+// infoOf - то же, что info, для уже открытого файла.
+func (s *FileStorage) infoOf(file *os.File, name string) (*FileInfo, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return s.infoFromStat(name, stat)
+}
+
+func (s *FileStorage) infoFromStat(name string, stat os.FileInfo) (*FileInfo, error) {
+	info := &FileInfo{
+		Name:      name,
+		Size:      stat.Size(),
+		CreatedAt: stat.ModTime(),
+		UpdatedAt: stat.ModTime(),
+	}
+
+	meta, err := s.readMeta(name)
+	if err != nil {
+		return nil, err
+	}
+	if meta != nil {
+		info.CreatedAt, info.UpdatedAt = meta.CreatedAt, meta.UpdatedAt
+		if meta.Size == info.Size {
+			info.SHA256, info.ContentType = meta.SHA256, meta.ContentType
+		}
+	}
+	return info, nil
+}
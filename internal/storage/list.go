@@ -0,0 +1,353 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+type OrderBy int
+
+const (
+	OrderByName OrderBy = iota
+	OrderByCreated
+	OrderByUpdated
+	OrderBySize
+)
+
+// ListOptions - параметры постраничного просмотра списка файлов.
+// Нулевые значения фильтров означают отсутствие ограничения.
+type ListOptions struct {
+	PageSize   int
+	PageToken  string
+	OrderBy    OrderBy
+	Descending bool
+
+	NamePrefix string
+	// NameGlob - шаблон имени в синтаксисе path.Match.
+	NameGlob string
+
+	// After - включительно, Before - не включая.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+}
+
+type ListResult struct {
+	Files []*FileInfo
+	// NextPageToken пуст на последней странице.
+	NextPageToken string
+}
+
+// pageToken - курсор на последний файл страницы. Следующая страница
+// начинается строго после него в порядке сортировки, поэтому загрузки
+// и удаления между запросами не приводят к повторам и пропускам файлов,
+// которые не менялись.
+type pageToken struct {
+	Order OrderBy `json:"o"`
+	Desc  bool    `json:"d,omitempty"`
+	// Key - значение ключа сортировки: время в наносекундах или размер.
+	Key    int64  `json:"k,omitempty"`
+	Name   string `json:"n"`
+	Filter string `json:"f"`
+}
+
+// DefaultListSortLimit - сколько файлов по умолчанию List готов
+// отсортировать не по имени ради одной страницы, см. WithListSortLimit.
+const DefaultListSortLimit = 100000
+
+// WithListSortLimit ограничивает число файлов, которые List сортирует
+// по дате или размеру ради одной страницы. Для такой сортировки нужно
+// прочитать сведения о каждом файле, подходящем под фильтры по имени,
+// поэтому запрос, под который подходит больше limit файлов, отклоняется
+// с ErrInvalidArg: его нужно сузить фильтрами по имени или сортировать
+// по имени. S3Storage так же читает весь список и при сортировке по имени
+// по убыванию. 0 - без ограничения. MemoryStorage держит сведения
+// о файлах в памяти и ограничение не применяет.
+func WithListSortLimit(limit int) Option {
+	return func(b *base) {
+		if limit >= 0 {
+			b.listSortLimit = limit
+		}
+	}
+}
+
+// checkSortLimit проверяет, что matched файлов, подходящих под фильтры
+// по имени, можно отсортировать по ключу opts.OrderBy.
+func (b *base) checkSortLimit(opts *ListOptions, matched int) error {
+	if opts.OrderBy == OrderByName {
+		return nil
+	}
+	return b.checkScanLimit(matched, "order by name")
+}
+
+// checkScanLimit проверяет, что ради одной страницы можно прочитать
+// сведения о matched файлах. hint - порядок, при котором этого не нужно.
+func (b *base) checkScanLimit(matched int, hint string) error {
+	if b.listSortLimit == 0 || matched <= b.listSortLimit {
+		return nil
+	}
+	return invalidArg("order_by", fmt.Sprintf(
+		"more than %d files match the request, narrow it with name_prefix or name_glob or %s", b.listSortLimit, hint))
+}
+
+// List возвращает страницу файлов, отсортированных по opts.OrderBy.
+// Файлы с одинаковым ключом сортировки упорядочиваются по имени.
+//
+// Индекса нет: каждая страница читает имена всех файлов хранилища,
+// в раскладке sharded - из всех 65536 каталогов. При сортировке по имени
+// сведения читаются только о файлах страницы, при сортировке по дате
+// или размеру - о каждом файле, подходящем под фильтры по имени,
+// поэтому число таких файлов ограничено, см. WithListSortLimit.
+func (s *FileStorage) List(ctx context.Context, opts ListOptions) (*ListResult, error) {
+	return s.index().list(opts)
+}
+
+// dirIndex - каталог, в котором каждому файлу хранилища соответствует
+// одна запись: сам файл или его метаданные.
+type dirIndex struct {
+	dir string
+	// levels - число уровней подкаталогов между dir и записями, см. walkShards.
+	levels int
+	// name возвращает имя файла по записи каталога или false для
+	// служебных записей.
+	name func(e os.DirEntry) (string, bool)
+	info func(name string) (*FileInfo, error)
+	// checkSort - проверка числа файлов для сортировки, см. checkSortLimit.
+	checkSort func(opts *ListOptions, matched int) error
+}
+
+// index - каталог хранилища, где записи и есть файлы.
+func (s *FileStorage) index() dirIndex {
+	return dirIndex{
+		dir:    s.storagePath,
+		levels: s.shards,
+		name: func(e os.DirEntry) (string, bool) {
+			return e.Name(), !e.IsDir() && !isTemp(e.Name())
+		},
+		info:      s.info,
+		checkSort: s.checkSortLimit,
+	}
+}
+
+func (d dirIndex) list(opts ListOptions) (*ListResult, error) {
+	after, err := opts.cursor()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	err = walkShards(d.dir, d.levels, func(dir string) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if name, ok := d.name(e); ok && opts.matchName(name) {
+				names = append(names, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := d.checkSort(&opts, len(names)); err != nil {
+		return nil, err
+	}
+
+	// Имена отсортированы по возрастанию, поэтому при сортировке
+	// по имени можно остановиться, как только набралась страница,
+	// и не читать сведения об остальных файлах.
+	slices.Sort(names)
+	byName := opts.OrderBy == OrderByName
+	if byName && opts.Descending {
+		slices.Reverse(names)
+	}
+
+	var files []*FileInfo
+	for _, name := range names {
+		if after != nil && byName && opts.compareTo(0, name, after) <= 0 {
+			continue
+		}
+
+		info, err := d.info(name)
+		if errors.Is(err, ErrNotFound) {
+			// Файл удалили между чтением каталога и чтением сведений о нём.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !opts.match(info, after) {
+			continue
+		}
+
+		files = append(files, info)
+		// На одну запись больше страницы - признак, что есть следующая.
+		if byName && len(files) > opts.PageSize {
+			break
+		}
+	}
+
+	return opts.page(files), nil
+}
+
+// cursor проверяет параметры просмотра и разбирает токен страницы.
+// Для первой страницы возвращает nil.
+func (o *ListOptions) cursor() (*pageToken, error) {
+	if o.PageSize <= 0 {
+		return nil, invalidArg("page_size", "must be positive")
+	}
+	if o.NameGlob != "" {
+		if _, err := path.Match(o.NameGlob, ""); err != nil {
+			return nil, invalidArg("name_glob", err.Error())
+		}
+	}
+	if o.PageToken == "" {
+		return nil, nil
+	}
+
+	tok, err := decodePageToken(o.PageToken)
+	if err != nil || tok.Order != o.OrderBy || tok.Desc != o.Descending || tok.Filter != o.filterHash() {
+		return nil, invalidArg("page_token", "malformed or does not match the request parameters")
+	}
+	return tok, nil
+}
+
+// match сообщает, проходит ли файл фильтры по времени и идёт ли он
+// после курсора after. Фильтры по имени проверяются отдельно, до
+// получения сведений о файле.
+func (o *ListOptions) match(fi *FileInfo, after *pageToken) bool {
+	if !o.matchTime(fi) {
+		return false
+	}
+	return after == nil || o.compareTo(o.key(fi), fi.Name, after) > 0
+}
+
+// page сортирует подходящие файлы и оставляет из них одну страницу.
+// Если файлов больше страницы, в результат добавляется токен следующей.
+func (o *ListOptions) page(files []*FileInfo) *ListResult {
+	slices.SortFunc(files, func(a, b *FileInfo) int {
+		return o.compare(o.key(a), a.Name, o.key(b), b.Name)
+	})
+
+	res := &ListResult{Files: files}
+	if len(files) > o.PageSize {
+		res.Files = files[:o.PageSize]
+		last := res.Files[len(res.Files)-1]
+		res.NextPageToken = encodePageToken(&pageToken{
+			Order:  o.OrderBy,
+			Desc:   o.Descending,
+			Key:    o.key(last),
+			Name:   last.Name,
+			Filter: o.filterHash(),
+		})
+	}
+	return res
+}
+
+func invalidArg(field, reason string) error {
+	return &Error{Kind: ErrInvalidArg, Op: "list", Field: field, Reason: reason}
+}
+
+func (o *ListOptions) matchName(name string) bool {
+	if !strings.HasPrefix(name, o.NamePrefix) {
+		return false
+	}
+	if o.NameGlob != "" {
+		if ok, _ := path.Match(o.NameGlob, name); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *ListOptions) matchTime(fi *FileInfo) bool {
+	inRange := func(t, after, before time.Time) bool {
+		return (after.IsZero() || !t.Before(after)) && (before.IsZero() || t.Before(before))
+	}
+	return inRange(fi.CreatedAt, o.CreatedAfter, o.CreatedBefore) &&
+		inRange(fi.UpdatedAt, o.UpdatedAfter, o.UpdatedBefore)
+}
+
+// key возвращает ключ сортировки файла. При сортировке по имени
+// ключ у всех файлов одинаковый и порядок определяется именем.
+func (o *ListOptions) key(fi *FileInfo) int64 {
+	switch o.OrderBy {
+	case OrderByCreated:
+		return fi.CreatedAt.UnixNano()
+	case OrderByUpdated:
+		return fi.UpdatedAt.UnixNano()
+	case OrderBySize:
+		return fi.Size
+	}
+	return 0
+}
+
+// compare сравнивает два файла в порядке сортировки запроса.
+func (o *ListOptions) compare(keyA int64, nameA string, keyB int64, nameB string) int {
+	c := cmp.Compare(keyA, keyB)
+	if c == 0 {
+		c = strings.Compare(nameA, nameB)
+	}
+	if o.Descending {
+		c = -c
+	}
+	return c
+}
+
+// compareTo сравнивает файл с позицией курсора.
+func (o *ListOptions) compareTo(key int64, name string, tok *pageToken) int {
+	return o.compare(key, name, tok.Key, tok.Name)
+}
+
+// filterHash привязывает курсор к фильтрам запроса, чтобы токен нельзя было
+// применить к другой выборке.
+func (o *ListOptions) filterHash() string {
+	h := sha256.New()
+	for _, part := range []string{
+		o.NamePrefix, o.NameGlob,
+		formatBound(o.CreatedAfter), formatBound(o.CreatedBefore),
+		formatBound(o.UpdatedAfter), formatBound(o.UpdatedBefore),
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+func formatBound(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func encodePageToken(tok *pageToken) string {
+	data, _ := json.Marshal(tok)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageToken(s string) (*pageToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var tok pageToken
+	if err := json.Unmarshal(data, &tok); err != nil {
+		return nil, err
+	}
+	return &tok, nil
+}
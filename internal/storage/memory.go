@@ -0,0 +1,383 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryPath - путь хранилища, при котором файлы хранятся в памяти.
+const MemoryPath = ":memory:"
+
+// MemoryStorage хранит файлы в памяти процесса с той же семантикой,
+// что и FileStorage. Данные теряются при перезапуске, поэтому хранилище
+// подходит для тестов и временных окружений.
+type MemoryStorage struct {
+	base
+	// mu защищает files и sessions. Данные файла после публикации
+	// не меняются, перезапись заменяет запись целиком.
+	mu       sync.RWMutex
+	files    map[string]*memFile
+	sessions map[string]*memSession
+}
+
+type memFile struct {
+	info FileInfo
+	data []byte
+}
+
+type memSession struct {
+	UploadSession
+	data []byte
+}
+
+var _ Backend = (*MemoryStorage)(nil)
+
+func NewMemoryStorage(opts ...Option) *MemoryStorage {
+	s := &MemoryStorage{
+		files:    make(map[string]*memFile),
+		sessions: make(map[string]*memSession),
+	}
+	s.init(opts)
+	return s
+}
+
+// memObject - версия файла в памяти, открытая для чтения.
+type memObject struct {
+	*bytes.Reader
+	info *FileInfo
+}
+
+func (o *memObject) Close() error {
+	return nil
+}
+
+func (o *memObject) Info() *FileInfo {
+	return o.info
+}
+
+// Put сохраняет файл с содержимым из r. Файл становится виден читателям
+// только после получения всех данных и их проверки.
+func (s *MemoryStorage) Put(ctx context.Context, hdr UploadHeader, r io.Reader) (*FileInfo, error) {
+	up, err := s.startUpload(hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := up.receive(ctx, &buf, r); err != nil {
+		up.abort()
+		return nil, err
+	}
+	content, err := up.finish()
+	if err != nil {
+		up.abort()
+		return nil, err
+	}
+
+	info, err := s.commit(hdr.Name, buf.Bytes(), content, hdr.Overwrite, hdr.IfMatch)
+	if err != nil {
+		up.abort()
+		return nil, err
+	}
+	return info, nil
+}
+
+// commit публикует данные под именем name с учётом политики перезаписи.
+func (s *MemoryStorage) commit(name string, data []byte, content contentInfo, policy OverwritePolicy, ifMatch string) (*FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	free := func(candidate string) error {
+		if s.files[candidate] != nil {
+			return &Error{Kind: ErrAlreadyExists, Op: "upload", Name: candidate}
+		}
+		return nil
+	}
+
+	switch policy {
+	case Overwrite:
+	case FailIfExists:
+		if err := free(name); err != nil {
+			return nil, err
+		}
+	case AutoRename:
+		var err error
+		if name, err = s.firstFree(name, free); err != nil {
+			return nil, err
+		}
+	case IfMatch:
+		f := s.files[name]
+		if f == nil {
+			return nil, noCurrentVersion(name)
+		}
+		if err := checkIfMatch(name, ifMatch, f.info.ETag()); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, unknownPolicy(name, policy)
+	}
+
+	// Как и в метаданных на диске, монотонное время не сохраняется.
+	now := time.Now().Round(0)
+	f := &memFile{
+		info: FileInfo{
+			Name:        name,
+			Size:        content.Size,
+			SHA256:      content.SHA256,
+			ContentType: content.ContentType,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		},
+		data: data,
+	}
+	if old := s.files[name]; old != nil {
+		f.info.CreatedAt = old.info.CreatedAt
+		s.release(old.info.Size)
+	}
+	s.files[name] = f
+
+	info := f.info
+	return &info, nil
+}
+
+// Open открывает файл для чтения.
+func (s *MemoryStorage) Open(ctx context.Context, name string) (Object, error) {
+	f, err := s.file("download", name)
+	if err != nil {
+		return nil, err
+	}
+	info := f.info
+	return &memObject{Reader: bytes.NewReader(f.data), info: &info}, nil
+}
+
+// Stat возвращает сведения о файле.
+func (s *MemoryStorage) Stat(ctx context.Context, name string) (*FileInfo, error) {
+	f, err := s.file("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info := f.info
+	return &info, nil
+}
+
+// Size возвращает размер файла.
+func (s *MemoryStorage) Size(ctx context.Context, name string) (int64, error) {
+	f, err := s.file("stat", name)
+	if err != nil {
+		return 0, err
+	}
+	return f.info.Size, nil
+}
+
+func (s *MemoryStorage) file(op, name string) (*memFile, error) {
+	if err := s.names.Validate(name); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f := s.files[name]
+	if f == nil {
+		return nil, &Error{Kind: ErrNotFound, Op: op, Name: name}
+	}
+	return f, nil
+}
+
+// Delete удаляет файл.
+func (s *MemoryStorage) Delete(ctx context.Context, name string) error {
+	if err := s.names.Validate(name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := s.files[name]
+	if f == nil {
+		return &Error{Kind: ErrNotFound, Op: "delete", Name: name}
+	}
+	delete(s.files, name)
+	s.release(f.info.Size)
+	return nil
+}
+
+// List возвращает страницу файлов, см. FileStorage.List.
+func (s *MemoryStorage) List(ctx context.Context, opts ListOptions) (*ListResult, error) {
+	after, err := opts.cursor()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var files []*FileInfo
+	for name, f := range s.files {
+		if !opts.matchName(name) || !opts.match(&f.info, after) {
+			continue
+		}
+		info := f.info
+		files = append(files, &info)
+	}
+	return opts.page(files), nil
+}
+
+// Walk обходит хранилище в порядке имён и передаёт fn сведения о файлах
+// пачками не больше opts.BatchSize. Файлы, загруженные после начала
+// обхода, в него не попадают.
+func (s *MemoryStorage) Walk(ctx context.Context, opts WalkOptions, fn func([]*FileInfo) error) error {
+	filter, err := opts.filter()
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	var files []*FileInfo
+	for name, f := range s.files {
+		if filter.matchName(name) {
+			info := f.info
+			files = append(files, &info)
+		}
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(files, func(a, b *FileInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	for batch := range slices.Chunk(files, opts.BatchSize) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartUpload создаёт сессию загрузки файла name.
+func (s *MemoryStorage) StartUpload(ctx context.Context, name string, policy OverwritePolicy, ifMatch string) (*UploadSession, error) {
+	sess, err := s.newSession(name, policy, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+	s.removeExpiredSessions()
+
+	s.mu.Lock()
+	s.sessions[sess.ID] = &memSession{UploadSession: *sess}
+	s.mu.Unlock()
+	return sess, nil
+}
+
+// UploadStatus возвращает состояние сессии загрузки.
+func (s *MemoryStorage) UploadStatus(ctx context.Context, id string) (*UploadSession, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sess, err := s.session(id)
+	if err != nil {
+		return nil, err
+	}
+	status := sess.UploadSession
+	return &status, nil
+}
+
+// WriteUpload дописывает в сессию данные из r начиная со смещения offset.
+// Всё, что успели получить до ошибки чтения r, сохраняется.
+func (s *MemoryStorage) WriteUpload(ctx context.Context, id string, offset int64, r io.Reader) (*UploadSession, error) {
+	if !s.lockSession(id) {
+		return nil, &Error{Kind: ErrSessionBusy, Op: "upload", Name: id}
+	}
+	defer s.unlockSession(id)
+
+	s.mu.RLock()
+	sess, err := s.session(id)
+	var name string
+	if err == nil {
+		name = sess.Name
+		if offset != sess.Offset {
+			err = &Error{Kind: ErrOffsetMismatch, Op: "upload", Name: name, Offset: sess.Offset}
+		}
+	}
+	s.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	n, err := s.receive(ctx, &buf, r, name, offset, -1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess.data = append(sess.data, buf.Bytes()...)
+	sess.Offset += n
+	sess.ExpiresAt = time.Now().Add(s.sessionTTL)
+	if err != nil {
+		return nil, err
+	}
+	status := sess.UploadSession
+	return &status, nil
+}
+
+// CommitUpload публикует файл, собранный в сессии, и удаляет сессию.
+// Если проверка или публикация не прошли, сессия остаётся.
+func (s *MemoryStorage) CommitUpload(ctx context.Context, id, expectedSHA256 string) (*FileInfo, error) {
+	if !s.lockSession(id) {
+		return nil, &Error{Kind: ErrSessionBusy, Op: "commit", Name: id}
+	}
+	defer s.unlockSession(id)
+
+	s.mu.RLock()
+	sess, err := s.session(id)
+	s.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := s.checkSession(&sess.UploadSession, expectedSHA256, bytes.NewReader(sess.data))
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.commit(sess.Name, sess.data, content, sess.Overwrite, sess.IfMatch)
+	if err != nil {
+		return nil, err
+	}
+
+	// Данные сессии стали файлом, место в квоте остаётся занятым.
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+	return info, nil
+}
+
+// session возвращает действующую сессию. Вызывается под s.mu.
+func (s *MemoryStorage) session(id string) (*memSession, error) {
+	sess := s.sessions[id]
+	if sess == nil || time.Now().After(sess.ExpiresAt) {
+		return nil, &Error{Kind: ErrSessionNotFound, Op: "upload", Name: id}
+	}
+	return sess, nil
+}
+
+// removeExpiredSessions удаляет просроченные сессии вместе с данными.
+// Сессии, в которые сейчас пишут или которые публикуют, пропускаются.
+func (s *MemoryStorage) removeExpiredSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, sess := range s.sessions {
+		if now.After(sess.ExpiresAt) && s.lockSession(id) {
+			delete(s.sessions, id)
+			s.release(int64(len(sess.data)))
+			s.unlockSession(id)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/krekio/TagesTest/internal/storage"
+	"github.com/krekio/TagesTest/internal/storage/storagetest"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, opts ...storage.Option) storage.Backend {
+		return storage.NewMemoryStorage(opts...)
+	})
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// metaDir - скрытый каталог внутри хранилища с метаданными файлов.
+// Для каждого файла хранится отдельный JSON рядом с остальными,
+// поэтому обновление одного файла не требует перезаписи общего индекса.
+const metaDir = ".meta"
+
+type fileMeta struct {
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+}
+
+func (s *FileStorage) metaPath(name string) string {
+	return filepath.Join(s.storagePath, metaDir, s.shard(name), name+".json")
+}
+
+// readMeta читает метаданные файла. Для файлов, загруженных до появления
+// метаданных, возвращает (nil, nil).
+func (s *FileStorage) readMeta(name string) (*fileMeta, error) {
+	data, err := os.ReadFile(s.metaPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var m fileMeta
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (s *FileStorage) writeMeta(name string, m *fileMeta) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	path := s.metaPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// touchMeta фиксирует загрузку файла: при первой загрузке выставляет
+// дату создания, при перезаписи обновляет только дату обновления.
+// Вызывается под s.metaMu.
+func (s *FileStorage) touchMeta(name string, now time.Time, content contentInfo) error {
+	m, err := s.readMeta(name)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		m = &fileMeta{CreatedAt: now}
+	}
+	m.UpdatedAt = now
+	m.Size, m.SHA256, m.ContentType = content.Size, content.SHA256, content.ContentType
+	return s.writeMeta(name, m)
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// OverwritePolicy определяет, что делать, если файл с таким именем уже есть.
+type OverwritePolicy int
+
+const (
+	// Overwrite заменяет существующий файл.
+	Overwrite OverwritePolicy = iota
+	// FailIfExists отклоняет загрузку с ErrAlreadyExists.
+	FailIfExists
+	// AutoRename сохраняет файл под свободным именем вида "foo (1).png".
+	AutoRename
+	// IfMatch заменяет файл, только если его ETag совпадает с ожидаемым,
+	// иначе возвращает ErrPreconditionFailed.
+	IfMatch
+)
+
+// maxAutoRename - сколько вариантов имени перебирает AutoRename.
+const maxAutoRename = 1000
+
+// publishFile публикует временный файл под его именем в каталоге
+// хранилища и возвращает сведения о нём.
+func (s *FileStorage) publishFile(tmpPath, name string, content contentInfo, policy OverwritePolicy, ifMatch string) (*FileInfo, error) {
+	name, err := s.commit(tmpPath, name, content, policy, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.info(name)
+	return info, afterPublish(err)
+}
+
+// commit публикует загруженный временный файл под именем name с учётом
+// политики перезаписи и обновляет метаданные. Проверка существующего файла
+// и публикация выполняются под s.metaMu, поэтому конкурентные загрузки
+// одного имени не могут обе пройти проверку. Возвращает итоговое имя файла.
+func (s *FileStorage) commit(tmpPath, name string, content contentInfo, policy OverwritePolicy, ifMatch string) (string, error) {
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+
+	switch policy {
+	case Overwrite:
+		if err := s.replace(tmpPath, name); err != nil {
+			return "", err
+		}
+	case FailIfExists:
+		if err := s.link(tmpPath, name); err != nil {
+			return "", err
+		}
+	case AutoRename:
+		var err error
+		if name, err = s.linkFree(tmpPath, name); err != nil {
+			return "", err
+		}
+	case IfMatch:
+		etag, err := s.currentETag(name)
+		if err != nil {
+			return "", err
+		}
+		if err := checkIfMatch(name, ifMatch, etag); err != nil {
+			return "", err
+		}
+		if err := s.replace(tmpPath, name); err != nil {
+			return "", err
+		}
+	default:
+		return "", unknownPolicy(name, policy)
+	}
+
+	if err := syncDir(filepath.Dir(s.filePath(name))); err != nil {
+		return "", afterPublish(err)
+	}
+	return name, afterPublish(s.touchMeta(name, time.Now(), content))
+}
+
+// replace публикует файл, заменяя существующий, и освобождает место,
+// которое занимала прежняя версия.
+func (s *FileStorage) replace(tmpPath, name string) error {
+	path := s.filePath(name)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	old := fileSize(path)
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	s.release(old)
+	return nil
+}
+
+// link публикует файл, только если имя свободно. Жёсткая ссылка не
+// перезаписывает существующий файл, в отличие от rename.
+func (s *FileStorage) link(tmpPath, name string) error {
+	path := s.filePath(name)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	err := os.Link(tmpPath, path)
+	if errors.Is(err, os.ErrExist) {
+		return &Error{Kind: ErrAlreadyExists, Op: "upload", Name: name}
+	}
+	if err != nil {
+		return err
+	}
+	return afterPublish(os.Remove(tmpPath))
+}
+
+// linkFree публикует файл под первым свободным именем, см. firstFree.
+func (s *FileStorage) linkFree(tmpPath, name string) (string, error) {
+	return s.firstFree(name, func(candidate string) error {
+		return s.link(tmpPath, candidate)
+	})
+}
+
+// firstFree вызывает publish для name, "name (1)", "name (2)" и так далее,
+// пока publish возвращает ErrAlreadyExists, и возвращает имя, под которым
+// файл опубликован. Номер вставляется перед расширением.
+func (s *base) firstFree(name string, publish func(candidate string) error) (string, error) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	candidate := name
+	for i := 1; ; i++ {
+		err := publish(candidate)
+		if !errors.Is(err, ErrAlreadyExists) {
+			return candidate, err
+		}
+		if i > maxAutoRename {
+			return "", &Error{Kind: ErrAlreadyExists, Op: "upload", Name: name, Reason: "no free name left"}
+		}
+
+		candidate = fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		if err := s.names.Validate(candidate); err != nil {
+			return "", &Error{Kind: ErrAlreadyExists, Op: "upload", Name: name, Reason: "no free name within the filename policy"}
+		}
+	}
+}
+
+// checkIfMatch сверяет ожидаемый ETag с ETag текущей версии файла.
+func checkIfMatch(name, ifMatch, etag string) error {
+	if ifMatch == "" || !matchETag(ifMatch, etag) {
+		return &Error{Kind: ErrPreconditionFailed, Op: "upload", Name: name, Field: "if_match",
+			Reason: fmt.Sprintf("current ETag is %s", etag)}
+	}
+	return nil
+}
+
+func unknownPolicy(name string, policy OverwritePolicy) error {
+	return &Error{Kind: ErrInvalidArg, Op: "upload", Name: name, Field: "overwrite",
+		Reason: fmt.Sprintf("unknown policy %d", policy)}
+}
+
+func noCurrentVersion(name string) error {
+	return &Error{Kind: ErrPreconditionFailed, Op: "upload", Name: name, Field: "if_match", Reason: "file does not exist"}
+}
+
+// currentETag возвращает ETag существующего файла. Вызывается под s.metaMu.
+func (s *FileStorage) currentETag(name string) (string, error) {
+	info, err := s.info(name)
+	if errors.Is(err, ErrNotFound) {
+		return "", noCurrentVersion(name)
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.SHA256 != "" {
+		return info.SHA256, nil
+	}
+
+	file, err := os.Open(s.filePath(name))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	content, err := digest(file)
+	if err != nil {
+		return "", err
+	}
+	return content.SHA256, nil
+}
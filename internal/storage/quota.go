@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Quota - ограничения на объём данных. Нулевые значения - без ограничений.
+type Quota struct {
+	// MaxFileSize - максимальный размер одного файла в байтах.
+	MaxFileSize int64
+	// MaxTotalSize - максимальный объём всех файлов хранилища в байтах,
+	// включая незавершённые загрузки.
+	MaxTotalSize int64
+}
+
+// WithQuota задаёт ограничения на размер файлов и объём хранилища.
+func WithQuota(q Quota) Option {
+	return func(b *base) {
+		b.quota = q
+	}
+}
+
+// checkFileSize проверяет, что файл размера size не превышает MaxFileSize.
+func (s *base) checkFileSize(op, name string, size int64) error {
+	if s.quota.MaxFileSize > 0 && size > s.quota.MaxFileSize {
+		return &Error{Kind: ErrTooLarge, Op: op, Name: name, Limit: s.quota.MaxFileSize,
+			Reason: fmt.Sprintf("%d bytes", size)}
+	}
+	return nil
+}
+
+// checkFree проверяет, что в хранилище есть место для n байт, не занимая его.
+func (s *base) checkFree(op, name string, n int64) error {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+
+	return s.quotaError(op, name, n)
+}
+
+// reserve учитывает n байт, записываемых на диск, или возвращает
+// ErrQuotaExceeded, если они не помещаются в MaxTotalSize.
+func (s *base) reserve(op, name string, n int64) error {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+
+	if err := s.quotaError(op, name, n); err != nil {
+		return err
+	}
+	s.used += n
+	return nil
+}
+
+func (s *base) quotaError(op, name string, n int64) error {
+	if s.quota.MaxTotalSize > 0 && s.used+n > s.quota.MaxTotalSize {
+		return &Error{Kind: ErrQuotaExceeded, Op: op, Name: name, Limit: s.quota.MaxTotalSize,
+			Reason: fmt.Sprintf("%d of %d bytes used", s.used, s.quota.MaxTotalSize)}
+	}
+	return nil
+}
+
+// release возвращает n байт, освобождённых на диске.
+func (s *base) release(n int64) {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+
+	s.used = max(s.used-n, 0)
+}
+
+// Usage возвращает занятый объём хранилища в байтах.
+func (s *base) Usage() int64 {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+
+	return s.used
+}
+
+// scanUsage считает занятый объём при запуске: файлы хранилища и части
+// незавершённых загрузок. Дальше объём учитывается при записи и удалении.
+func (s *FileStorage) scanUsage() error {
+	var used int64
+	count := func(dir string, match func(name string) bool) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if !e.Type().IsRegular() || !match(e.Name()) {
+				continue
+			}
+			info, err := e.Info()
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			used += info.Size()
+		}
+		return nil
+	}
+
+	err := walkShards(s.storagePath, s.shards, func(dir string) error {
+		return count(dir, func(name string) bool { return !strings.HasPrefix(name, ".") })
+	})
+	if err != nil {
+		return err
+	}
+	err = count(filepath.Join(s.storagePath, uploadsDir), func(name string) bool { return strings.HasSuffix(name, ".part") })
+	if err != nil {
+		return err
+	}
+
+	s.usageMu.Lock()
+	s.used = used
+	s.usageMu.Unlock()
+	return nil
+}
+
+// fileSize возвращает размер файла или 0, если его нет.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
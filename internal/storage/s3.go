@@ -0,0 +1,844 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krekio/TagesTest/internal/s3"
+	"golang.org/x/sync/errgroup"
+)
+
+// S3Config - бакет S3-совместимого хранилища для S3Storage.
+type S3Config struct {
+	s3.Config
+	// Prefix - общее начало ключей хранилища в бакете, например "tages/".
+	Prefix string
+	// PartSize - размер части multipart-загрузки в байтах. Файлы меньше
+	// него загружаются одним запросом.
+	PartSize int64
+}
+
+// DefaultS3PartSize - размер части multipart-загрузки по умолчанию.
+const DefaultS3PartSize = 8 << 20
+
+// Метаданные файла хранятся в x-amz-meta-* самого объекта, поэтому
+// содержимое и сведения о нём всегда меняются вместе.
+const (
+	s3MetaSHA256    = "sha256"
+	s3MetaCreatedAt = "created-at"
+	s3MetaUpdatedAt = "updated-at"
+)
+
+// s3HeadConcurrency - сколько запросов HEAD выполняется одновременно
+// при просмотре списка файлов.
+const s3HeadConcurrency = 16
+
+// copyPartSize - размер части при копировании объекта по частям.
+const copyPartSize = 512 << 20
+
+// S3Storage хранит файлы в бакете S3-совместимого хранилища с той же
+// семантикой, что и FileStorage. Раскладка ключей повторяет каталог
+// хранилища на диске:
+//
+//	<prefix><name>                              - файлы
+//	<prefix>.uploads/.tmp-upload-<random>       - загружаемые через Put данные
+//	<prefix>.uploads/<id>.json                  - состояние сессии загрузки
+//	<prefix>.uploads/<id>/<offset>              - части данных сессии
+//
+// S3 не умеет переименовывать объекты, поэтому файл сначала загружается
+// под временным ключом, а после проверки копируется под итоговым именем
+// вместе с метаданными. Проверки политики перезаписи и учёт квоты
+// выполняются в процессе, поэтому с одним префиксом должен работать
+// один экземпляр сервера.
+type S3Storage struct {
+	base
+	client   *s3.Client
+	prefix   string
+	partSize int64
+	// mu упорядочивает публикацию и удаление файлов.
+	mu sync.Mutex
+}
+
+var _ Backend = (*S3Storage)(nil)
+
+func NewS3Storage(cfg S3Config, opts ...Option) (*S3Storage, error) {
+	client, err := s3.New(cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &S3Storage{client: client, prefix: cfg.Prefix, partSize: cfg.PartSize}
+	if s.prefix != "" && !strings.HasSuffix(s.prefix, "/") {
+		s.prefix += "/"
+	}
+	if s.partSize <= 0 {
+		s.partSize = DefaultS3PartSize
+	}
+	s.init(opts)
+
+	ctx := context.Background()
+	if err := s.removeExpiredSessions(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.abortStaleUploads(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.scanUsage(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *S3Storage) key(name string) string {
+	return s.prefix + name
+}
+
+func (s *S3Storage) uploadsPrefix() string {
+	return s.prefix + uploadsDir + "/"
+}
+
+// objectError переводит ошибку S3 об отсутствии объекта в ErrNotFound.
+func objectError(op, name string, err error) error {
+	if s3.IsNotFound(err) {
+		return &Error{Kind: ErrNotFound, Op: op, Name: name}
+	}
+	return err
+}
+
+// Put сохраняет файл с содержимым из r. Данные загружаются под временным
+// ключом и публикуются только после получения всех данных и их проверки,
+// см. FileStorage.Put.
+func (s *S3Storage) Put(ctx context.Context, hdr UploadHeader, r io.Reader) (info *FileInfo, err error) {
+	up, err := s.startUpload(hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.stagingKey()
+	if err != nil {
+		return nil, err
+	}
+	w := s.newWriter(ctx, key)
+	defer func() {
+		if err != nil {
+			w.abort()
+			if !isPublished(err) {
+				up.abort()
+			}
+		}
+	}()
+
+	if err := up.receive(ctx, w, r); err != nil {
+		return nil, err
+	}
+	content, err := up.finish()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return s.commit(ctx, w.key, hdr.Name, content, hdr.Overwrite, hdr.IfMatch)
+}
+
+func (s *S3Storage) stagingKey() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return s.uploadsPrefix() + tmpPrefix + "upload-" + hex.EncodeToString(id), nil
+}
+
+// commit публикует объект src под именем name с учётом политики
+// перезаписи и удаляет src. Публикация доводится до конца и при отмене
+// ctx, чтобы не оставить файл без удалённого временного объекта.
+func (s *S3Storage) commit(ctx context.Context, src, name string, content contentInfo, policy OverwritePolicy, ifMatch string) (*FileInfo, error) {
+	ctx = context.WithoutCancel(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var old *FileInfo
+	current := func(candidate string) error {
+		var err error
+		old, err = s.head(ctx, "upload", candidate)
+		if errors.Is(err, ErrNotFound) {
+			old = nil
+			return nil
+		}
+		return err
+	}
+	free := func(candidate string) error {
+		if err := current(candidate); err != nil {
+			return err
+		}
+		if old != nil {
+			return &Error{Kind: ErrAlreadyExists, Op: "upload", Name: candidate}
+		}
+		return nil
+	}
+
+	switch policy {
+	case Overwrite:
+		if err := current(name); err != nil {
+			return nil, err
+		}
+	case FailIfExists:
+		if err := free(name); err != nil {
+			return nil, err
+		}
+	case AutoRename:
+		var err error
+		if name, err = s.firstFree(name, free); err != nil {
+			return nil, err
+		}
+	case IfMatch:
+		if err := current(name); err != nil {
+			return nil, err
+		}
+		if old == nil {
+			return nil, noCurrentVersion(name)
+		}
+		if err := checkIfMatch(name, ifMatch, old.ETag()); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, unknownPolicy(name, policy)
+	}
+
+	now := time.Now()
+	created := now
+	if old != nil {
+		created = old.CreatedAt
+	}
+	meta := fileMetadata(content.SHA256, created, now)
+	if err := s.copy(ctx, src, s.key(name), content.Size, content.ContentType, meta); err != nil {
+		return nil, err
+	}
+	if old != nil {
+		s.release(old.Size)
+	}
+	if err := s.client.DeleteObject(ctx, src); err != nil {
+		return nil, afterPublish(err)
+	}
+
+	return s.fileInfo(name, &s3.ObjectInfo{Size: content.Size, ContentType: content.ContentType, Metadata: meta}), nil
+}
+
+// copy копирует объект src размера size в dst с новыми метаданными.
+// Объекты больше s3.MaxCopySize копируются по частям.
+func (s *S3Storage) copy(ctx context.Context, src, dst string, size int64, contentType string, meta map[string]string) error {
+	if size <= s3.MaxCopySize {
+		return s.client.CopyObject(ctx, src, "", dst, contentType, meta)
+	}
+	uploadID, parts, err := s.copyParts(ctx, src, "", dst, size, contentType, meta)
+	if err != nil {
+		return err
+	}
+	return s.complete(ctx, dst, uploadID, parts)
+}
+
+// copyParts начинает multipart-загрузку dst и копирует в неё объект src
+// размера size по частям. Если srcETag не пуст, копируется только версия
+// src с этим ETag. При ошибке загрузка отменяется.
+func (s *S3Storage) copyParts(ctx context.Context, src, srcETag, dst string, size int64, contentType string, meta map[string]string) (string, []s3.Part, error) {
+	uploadID, err := s.client.CreateMultipartUpload(ctx, dst, contentType, meta)
+	if err != nil {
+		return "", nil, err
+	}
+	var parts []s3.Part
+	for offset := int64(0); offset < size; offset += copyPartSize {
+		part, err := s.client.UploadPartCopy(ctx, dst, uploadID, len(parts)+1, src, srcETag, offset, min(copyPartSize, size-offset))
+		if err != nil {
+			s.client.AbortMultipartUpload(context.WithoutCancel(ctx), dst, uploadID)
+			return "", nil, err
+		}
+		parts = append(parts, part)
+	}
+	return uploadID, parts, nil
+}
+
+// complete собирает объект key из частей parts, а при ошибке отменяет загрузку.
+func (s *S3Storage) complete(ctx context.Context, key, uploadID string, parts []s3.Part) error {
+	if err := s.client.CompleteMultipartUpload(ctx, key, uploadID, parts); err != nil {
+		s.client.AbortMultipartUpload(ctx, key, uploadID)
+		return err
+	}
+	return nil
+}
+
+func fileMetadata(sha string, created, updated time.Time) map[string]string {
+	return map[string]string{
+		s3MetaSHA256:    sha,
+		s3MetaCreatedAt: created.UTC().Format(time.RFC3339Nano),
+		s3MetaUpdatedAt: updated.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// head возвращает сведения о файле по запросу HEAD.
+func (s *S3Storage) head(ctx context.Context, op, name string) (*FileInfo, error) {
+	obj, err := s.client.HeadObject(ctx, s.key(name))
+	if err != nil {
+		return nil, objectError(op, name, err)
+	}
+	return s.fileInfo(name, obj), nil
+}
+
+// Size возвращает размер объекта по HEAD-запросу, не досчитывая сумму.
+func (s *S3Storage) Size(ctx context.Context, name string) (int64, error) {
+	if err := s.names.Validate(name); err != nil {
+		return 0, err
+	}
+	info, err := s.head(ctx, "stat", name)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+// fileInfo собирает сведения о файле из метаданных объекта. У объектов,
+// загруженных в бакет в обход сервера, метаданных нет: даты берутся из
+// Last-Modified, а суммы нет, пока её не сохранит FillDigests.
+func (s *S3Storage) fileInfo(name string, obj *s3.ObjectInfo) *FileInfo {
+	info := &FileInfo{
+		Name:        name,
+		Size:        obj.Size,
+		SHA256:      obj.Metadata[s3MetaSHA256],
+		ContentType: obj.ContentType,
+		CreatedAt:   obj.LastModified,
+		UpdatedAt:   obj.LastModified,
+	}
+	if t, err := time.Parse(time.RFC3339Nano, obj.Metadata[s3MetaCreatedAt]); err == nil {
+		info.CreatedAt = t
+	}
+	if t, err := time.Parse(time.RFC3339Nano, obj.Metadata[s3MetaUpdatedAt]); err == nil {
+		info.UpdatedAt = t
+	}
+	return info
+}
+
+// Stat возвращает сведения о файле. У объектов, загруженных в бакет
+// в обход сервера, сумма пуста, пока её не сохранит FillDigests.
+func (s *S3Storage) Stat(ctx context.Context, name string) (*FileInfo, error) {
+	if err := s.names.Validate(name); err != nil {
+		return nil, err
+	}
+	return s.head(ctx, "stat", name)
+}
+
+// FillDigests сохраняет суммы объектов, загруженных в бакет в обход
+// сервера, чтобы у них появился ETag. Stat и Open объекты не изменяют,
+// поэтому проход запускается отдельно командой tages-migrate. Возвращает
+// число объектов, для которых сумма сохранена.
+func (s *S3Storage) FillDigests(ctx context.Context) (int, error) {
+	filled := 0
+	err := s.scan(ctx, "", "", 1000, func(names []string) (bool, error) {
+		for _, name := range names {
+			obj, err := s.client.HeadObject(ctx, s.key(name))
+			if s3.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+			if obj.Metadata[s3MetaSHA256] != "" {
+				continue
+			}
+			saved, err := s.fillDigest(ctx, obj, s.fileInfo(name, obj))
+			if err != nil {
+				return false, fmt.Errorf("%s: %w", name, err)
+			}
+			if saved {
+				filled++
+			}
+		}
+		return true, nil
+	})
+	return filled, err
+}
+
+// fillDigest считает сумму и тип объекта obj и сохраняет их в метаданные
+// копированием объекта в себя. Чтение и копирование по частям идут без
+// s.mu и только из версии obj, а под s.mu объект лишь собирается из
+// скопированных частей, если его за это время не заменили. Иначе сумма
+// не сохраняется и возвращается false.
+func (s *S3Storage) fillDigest(ctx context.Context, obj *s3.ObjectInfo, info *FileInfo) (bool, error) {
+	body, _, err := s.client.GetObject(ctx, obj.Key, 0, 0, obj.ETag)
+	if err != nil {
+		return false, ignoreReplaced(err)
+	}
+	content, err := digest(body)
+	body.Close()
+	if err != nil {
+		return false, ignoreReplaced(err)
+	}
+	meta := fileMetadata(content.SHA256, info.CreatedAt, info.UpdatedAt)
+
+	if obj.Size == 0 {
+		// Пустой объект не копируется по частям, а его копия не занимает времени.
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		err := s.client.CopyObject(ctx, obj.Key, obj.ETag, obj.Key, content.ContentType, meta)
+		return err == nil, ignoreReplaced(err)
+	}
+
+	uploadID, parts, err := s.copyParts(ctx, obj.Key, obj.ETag, obj.Key, obj.Size, content.ContentType, meta)
+	if err != nil {
+		return false, ignoreReplaced(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.client.HeadObject(ctx, obj.Key)
+	if err != nil || current.ETag != obj.ETag {
+		s.client.AbortMultipartUpload(ctx, obj.Key, uploadID)
+		return false, ignoreReplaced(err)
+	}
+	if err := s.complete(ctx, obj.Key, uploadID, parts); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ignoreReplaced пропускает ошибку копирования объекта, который заменили
+// или удалили: сохранять сумму прежней версии уже незачем.
+func ignoreReplaced(err error) error {
+	if s3.IsPreconditionFailed(err) || s3.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// Open открывает файл для чтения. Данные читаются запросами GET с
+// диапазоном по мере обращения, и только из той версии объекта, которая
+// была открыта: если файл заменят, чтение вернёт ErrPreconditionFailed.
+func (s *S3Storage) Open(ctx context.Context, name string) (Object, error) {
+	if err := s.names.Validate(name); err != nil {
+		return nil, err
+	}
+
+	obj, err := s.client.HeadObject(ctx, s.key(name))
+	if err != nil {
+		return nil, objectError("download", name, err)
+	}
+	return &s3Object{objectReader: s.newReader(ctx, name, obj), info: s.fileInfo(name, obj)}, nil
+}
+
+// s3Object - версия файла в бакете, открытая для чтения.
+type s3Object struct {
+	*objectReader
+	info *FileInfo
+}
+
+func (o *s3Object) Info() *FileInfo {
+	return o.info
+}
+
+// objectReader читает версию объекта с заданным ETag. Каждый GET
+// запрашивает закрытый диапазон не больше s3ReadAhead байт, и
+// последовательные ReadAt читают один ответ, пока он не кончится.
+// Запрос повторяется при переходе к другому смещению или к следующему
+// диапазону.
+type objectReader struct {
+	// ctx - контекст запроса, открывшего объект: чтение идёт, пока
+	// запрос не завершён.
+	ctx    context.Context
+	client *s3.Client
+	name   string
+	key    string
+	etag   string
+	size   int64
+
+	mu   sync.Mutex
+	body io.ReadCloser
+	pos  int64
+	// end - конец диапазона, запрошенного для body.
+	end int64
+}
+
+// s3ReadAhead - наибольший диапазон объекта, который запрашивает один GET
+// при чтении файла. Ответ закрывается, если чтение перешло к другому
+// смещению, и ограничение не даёт хранилищу отправлять лишнее.
+const s3ReadAhead = 8 << 20
+
+func (s *S3Storage) newReader(ctx context.Context, name string, obj *s3.ObjectInfo) *objectReader {
+	return &objectReader{ctx: ctx, client: s.client, name: name, key: obj.Key, etag: obj.ETag, size: obj.Size}
+}
+
+func (r *objectReader) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	want := int(min(int64(len(p)), r.size-off))
+
+	n := 0
+	for n < want {
+		if err := r.seek(off + int64(n)); err != nil {
+			return n, err
+		}
+		m, err := io.ReadFull(r.body, p[n:n+int(min(int64(want-n), r.end-r.pos))])
+		n += m
+		r.pos += int64(m)
+		if err != nil {
+			r.closeBody()
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// seek готовит body к чтению со смещения off, запрашивая новый диапазон,
+// если текущий ответ читается не с off или уже прочитан.
+func (r *objectReader) seek(off int64) error {
+	if r.body != nil && r.pos == off && r.pos < r.end {
+		return nil
+	}
+	r.closeBody()
+	length := min(s3ReadAhead, r.size-off)
+	body, _, err := r.client.GetObject(r.ctx, r.key, off, length, r.etag)
+	if s3.IsPreconditionFailed(err) {
+		return &Error{Kind: ErrPreconditionFailed, Op: "download", Name: r.name, Reason: "file was replaced while reading"}
+	}
+	if err != nil {
+		return err
+	}
+	r.body, r.pos, r.end = body, off, off+length
+	return nil
+}
+
+func (r *objectReader) closeBody() {
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+}
+
+func (r *objectReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closeBody()
+	return nil
+}
+
+// Delete удаляет файл.
+func (s *S3Storage) Delete(ctx context.Context, name string) error {
+	if err := s.names.Validate(name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := s.head(ctx, "delete", name)
+	if err != nil {
+		return err
+	}
+	if err := s.client.DeleteObject(ctx, s.key(name)); err != nil {
+		return err
+	}
+	s.release(info.Size)
+	return nil
+}
+
+// List возвращает страницу файлов, см. FileStorage.List. Сведения о
+// файлах хранятся в метаданных объектов, поэтому на каждый подходящий
+// по имени файл выполняется HEAD. При сортировке по имени по возрастанию
+// список читается с позиции курсора и только до конца страницы. S3 отдаёт
+// ключи только по возрастанию, поэтому при остальных порядках, включая
+// имя по убыванию, список читается целиком, см. WithListSortLimit.
+func (s *S3Storage) List(ctx context.Context, opts ListOptions) (*ListResult, error) {
+	after, err := opts.cursor()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := opts.OrderBy == OrderByName && !opts.Descending
+	startAfter, pageKeys := "", 0
+	if byName {
+		pageKeys = min(opts.PageSize+1, 1000)
+		if after != nil {
+			startAfter = after.Name
+		}
+	}
+
+	var files []*FileInfo
+	matched := 0
+	err = s.scan(ctx, opts.NamePrefix, startAfter, pageKeys, func(names []string) (bool, error) {
+		names = filterNames(names, &opts)
+		matched += len(names)
+		if !byName {
+			if err := s.checkScanLimit(matched, "order by name ascending"); err != nil {
+				return false, err
+			}
+		}
+		infos, err := s.infos(ctx, names)
+		if err != nil {
+			return false, err
+		}
+		for _, info := range infos {
+			if opts.match(info, after) {
+				files = append(files, info)
+			}
+		}
+		// На одну запись больше страницы - признак, что есть следующая.
+		return !byName || len(files) <= opts.PageSize, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return opts.page(files), nil
+}
+
+// Walk обходит хранилище в порядке имён и передаёт fn сведения о файлах
+// пачками не больше opts.BatchSize, читая список ключей постранично.
+func (s *S3Storage) Walk(ctx context.Context, opts WalkOptions, fn func([]*FileInfo) error) error {
+	filter, err := opts.filter()
+	if err != nil {
+		return err
+	}
+
+	var batch []*FileInfo
+	err = s.scan(ctx, filter.NamePrefix, "", min(opts.BatchSize, 1000), func(names []string) (bool, error) {
+		infos, err := s.infos(ctx, filterNames(names, filter))
+		if err != nil {
+			return false, err
+		}
+		for _, info := range infos {
+			batch = append(batch, info)
+			if len(batch) == opts.BatchSize {
+				if err := fn(batch); err != nil {
+					return false, err
+				}
+				batch = nil
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
+
+func filterNames(names []string, opts *ListOptions) []string {
+	var out []string
+	for _, name := range names {
+		if opts.matchName(name) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// scan читает имена файлов с началом namePrefix после startAfter по
+// возрастанию, страницами до maxKeys ключей (0 - по умолчанию S3), и
+// передаёт их fn, пока та возвращает true.
+func (s *S3Storage) scan(ctx context.Context, namePrefix, startAfter string, maxKeys int, fn func(names []string) (bool, error)) error {
+	opts := s3.ListOptions{
+		Prefix:    s.key(namePrefix),
+		Delimiter: "/",
+		MaxKeys:   maxKeys,
+	}
+	if startAfter != "" {
+		opts.StartAfter = s.key(startAfter)
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		res, err := s.client.ListObjects(ctx, opts)
+		if err != nil {
+			return err
+		}
+
+		var names []string
+		for _, obj := range res.Objects {
+			name := strings.TrimPrefix(obj.Key, s.prefix)
+			// Служебные ключи начинаются с точки, как и на диске.
+			if !strings.HasPrefix(name, ".") {
+				names = append(names, name)
+			}
+		}
+		more, err := fn(names)
+		if err != nil || !more || res.NextContinuationToken == "" {
+			return err
+		}
+		opts.ContinuationToken = res.NextContinuationToken
+	}
+}
+
+// infos получает сведения о файлах параллельными запросами HEAD, сохраняя
+// порядок. Файлы, удалённые после чтения списка, пропускаются.
+func (s *S3Storage) infos(ctx context.Context, names []string) ([]*FileInfo, error) {
+	infos := make([]*FileInfo, len(names))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(s3HeadConcurrency)
+	for i, name := range names {
+		g.Go(func() error {
+			info, err := s.head(ctx, "list", name)
+			if errors.Is(err, ErrNotFound) {
+				return nil
+			}
+			infos[i] = info
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	out := infos[:0]
+	for _, info := range infos {
+		if info != nil {
+			out = append(out, info)
+		}
+	}
+	return out, nil
+}
+
+// scanUsage считает занятый объём при запуске: файлы хранилища и части
+// незавершённых загрузок, см. FileStorage.scanUsage.
+func (s *S3Storage) scanUsage(ctx context.Context) error {
+	var used int64
+	opts := s3.ListOptions{Prefix: s.prefix}
+	for {
+		res, err := s.client.ListObjects(ctx, opts)
+		if err != nil {
+			return err
+		}
+		for _, obj := range res.Objects {
+			rest := strings.TrimPrefix(obj.Key, s.prefix)
+			session, isSession := strings.CutPrefix(rest, uploadsDir+"/")
+			switch {
+			case isSession && strings.Contains(session, "/"):
+				used += obj.Size
+			case !strings.HasPrefix(rest, ".") && !strings.Contains(rest, "/"):
+				used += obj.Size
+			}
+		}
+		if res.NextContinuationToken == "" {
+			break
+		}
+		opts.ContinuationToken = res.NextContinuationToken
+	}
+
+	s.usageMu.Lock()
+	s.used = used
+	s.usageMu.Unlock()
+	return nil
+}
+
+// s3Writer загружает данные в объект key: пока их меньше части - одним
+// PutObject при Close, иначе multipart-загрузкой по мере записи. Объект
+// появляется в бакете только после успешного Close.
+type s3Writer struct {
+	ctx      context.Context
+	client   *s3.Client
+	key      string
+	partSize int64
+
+	buf      []byte
+	uploadID string
+	parts    []s3.Part
+	closed   bool
+	// err - ошибка загрузки части. После неё данные в буфере
+	// неполные, и объект уже не может быть опубликован.
+	err error
+}
+
+func (s *S3Storage) newWriter(ctx context.Context, key string) *s3Writer {
+	return &s3Writer{ctx: ctx, client: s.client, key: key, partSize: s.partSize}
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buf = append(w.buf, p...)
+	for int64(len(w.buf)) >= w.partSize {
+		if w.err = w.flush(w.buf[:w.partSize]); w.err != nil {
+			return 0, w.err
+		}
+		w.buf = append(w.buf[:0], w.buf[w.partSize:]...)
+	}
+	return len(p), nil
+}
+
+func (w *s3Writer) flush(part []byte) error {
+	if w.uploadID == "" {
+		id, err := w.client.CreateMultipartUpload(w.ctx, w.key, "", nil)
+		if err != nil {
+			return err
+		}
+		w.uploadID = id
+	}
+	if len(w.parts) == s3.MaxParts {
+		return errors.New("s3: too many parts, increase the part size")
+	}
+	uploaded, err := w.client.UploadPart(w.ctx, w.key, w.uploadID, len(w.parts)+1, part)
+	if err != nil {
+		return err
+	}
+	w.parts = append(w.parts, uploaded)
+	return nil
+}
+
+// Close дозагружает остаток данных и публикует объект.
+func (w *s3Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.uploadID == "" {
+		if err := w.client.PutObject(w.ctx, w.key, w.buf, "", nil); err != nil {
+			return err
+		}
+	} else {
+		if len(w.buf) > 0 {
+			if err := w.flush(w.buf); err != nil {
+				return err
+			}
+		}
+		if err := w.client.CompleteMultipartUpload(w.ctx, w.key, w.uploadID, w.parts); err != nil {
+			return err
+		}
+	}
+	w.buf = nil
+	w.closed = true
+	return nil
+}
+
+// abort удаляет всё, что успел загрузить writer.
+func (w *s3Writer) abort() {
+	ctx := context.WithoutCancel(w.ctx)
+	switch {
+	case w.closed:
+		w.client.DeleteObject(ctx, w.key)
+	case w.uploadID != "":
+		w.client.AbortMultipartUpload(ctx, w.key, w.uploadID)
+	}
+	w.buf = nil
+}
@@ -0,0 +1,182 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/krekio/TagesTest/internal/s3"
+	"github.com/krekio/TagesTest/internal/s3/s3test"
+	"github.com/krekio/TagesTest/internal/storage"
+	"github.com/krekio/TagesTest/internal/storage/storagetest"
+)
+
+func TestS3Storage(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(*s3test.Server) storage.S3Config
+	}{
+		{"default parts", func(srv *s3test.Server) storage.S3Config {
+			return storage.S3Config{Config: srv.Config(), Prefix: "files"}
+		}},
+		// Маленькие части, чтобы файлы из тестов загружались и собирались
+		// multipart-загрузкой.
+		{"small parts", func(srv *s3test.Server) storage.S3Config {
+			srv.MinPartSize = 1
+			return storage.S3Config{Config: srv.Config(), PartSize: 3}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storagetest.Run(t, func(t *testing.T, opts ...storage.Option) storage.Backend {
+				srv := s3test.NewServer("bucket")
+				t.Cleanup(srv.Close)
+				s, err := storage.NewS3Storage(tt.cfg(srv), opts...)
+				if err != nil {
+					t.Fatalf("NewS3Storage: %v", err)
+				}
+				return s
+			})
+		})
+	}
+}
+
+func TestS3FillDigests(t *testing.T) {
+	ctx := context.Background()
+	srv := s3test.NewServer("bucket")
+	defer srv.Close()
+	client, err := s3.New(srv.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Объекты, загруженные в бакет в обход сервера.
+	for key, data := range map[string]string{"legacy.txt": "legacy", "empty.txt": ""} {
+		if err := client.PutObject(ctx, key, []byte(data), "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, err := client.HeadObject(ctx, "legacy.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := storage.NewS3Storage(storage.S3Config{Config: srv.Config()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Чтение объект не изменяет.
+	info, err := s.Stat(ctx, "legacy.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.SHA256 != "" {
+		t.Fatalf("SHA256 = %s before FillDigests", info.SHA256)
+	}
+	f, err := s.Open(ctx, "legacy.txt")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	data, err := io.ReadAll(io.NewSectionReader(f, 0, f.Info().Size))
+	f.Close()
+	if err != nil || string(data) != "legacy" {
+		t.Fatalf("read %q, %v", data, err)
+	}
+	if obj, err := client.HeadObject(ctx, "legacy.txt"); err != nil || obj.ETag != before.ETag {
+		t.Fatalf("object rewritten by Stat or Open: %v", err)
+	}
+
+	filled, err := s.FillDigests(ctx)
+	if err != nil || filled != 2 {
+		t.Fatalf("FillDigests = %d, %v, want 2", filled, err)
+	}
+	if filled, err := s.FillDigests(ctx); err != nil || filled != 0 {
+		t.Fatalf("second FillDigests = %d, %v, want 0", filled, err)
+	}
+	for name, data := range map[string]string{"legacy.txt": "legacy", "empty.txt": ""} {
+		info, err := s.Stat(ctx, name)
+		if err != nil {
+			t.Fatalf("Stat: %v", err)
+		}
+		sum := sha256.Sum256([]byte(data))
+		if want := hex.EncodeToString(sum[:]); info.SHA256 != want {
+			t.Fatalf("%s: SHA256 = %s, want %s", name, info.SHA256, want)
+		}
+	}
+	if srv.Uploads() != 0 {
+		t.Fatalf("%d multipart uploads left", srv.Uploads())
+	}
+}
+
+func TestS3AbortsStaleUploads(t *testing.T) {
+	ctx := context.Background()
+	srv := s3test.NewServer("bucket")
+	defer srv.Close()
+	client, err := s3.New(srv.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Загрузки, брошенные упавшим процессом, и загрузка вне префикса хранилища.
+	for _, key := range []string{"files/.uploads/.tmp-upload-1", "files/photo.png", "other/file"} {
+		if _, err := client.CreateMultipartUpload(ctx, key, "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := storage.S3Config{Config: srv.Config(), Prefix: "files"}
+	if _, err := storage.NewS3Storage(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Uploads(); n != 3 {
+		t.Fatalf("%d uploads left, want 3: fresh uploads must be kept", n)
+	}
+
+	time.Sleep(time.Millisecond)
+	if _, err := storage.NewS3Storage(cfg, storage.WithUploadSessionTTL(time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	uploads, err := client.ListMultipartUploads(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploads) != 1 || uploads[0].Key != "other/file" {
+		t.Fatalf("uploads left: %+v", uploads)
+	}
+}
+
+func TestS3ReadAcrossRanges(t *testing.T) {
+	ctx := context.Background()
+	srv := s3test.NewServer("bucket")
+	defer srv.Close()
+	s, err := storage.NewS3Storage(storage.S3Config{Config: srv.Config()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Больше диапазона одного GET, чтобы чтение переходило к следующему.
+	data := make([]byte, 9<<20)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	if _, err := s.Put(ctx, storage.UploadHeader{Name: "big.bin", Size: -1}, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := s.Open(ctx, "big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+
+	got, err := io.ReadAll(io.NewSectionReader(obj, 0, obj.Info().Size))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("sequential read: %d bytes, equal %v, %v", len(got), bytes.Equal(got, data), err)
+	}
+	buf := make([]byte, 1<<20)
+	off := int64(8<<20 - 1000)
+	if _, err := obj.ReadAt(buf, off); err != nil || !bytes.Equal(buf, data[off:off+int64(len(buf))]) {
+		t.Fatalf("ReadAt across a range boundary: %v", err)
+	}
+}
@@ -0,0 +1,382 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/krekio/TagesTest/internal/s3"
+)
+
+// s3Session - состояние сессии загрузки в бакете. Объект в S3 нельзя
+// дописать, поэтому каждый вызов WriteUpload сохраняет полученные данные
+// отдельным объектом-частью, а CommitUpload собирает файл из частей.
+type s3Session struct {
+	UploadSession
+	// Parts - размеры сохранённых частей по порядку. Часть с данными
+	// начиная со смещения offset хранится под segmentKey(id, offset).
+	Parts []int64 `json:"parts"`
+}
+
+func (s *S3Storage) sessionKey(id string) string {
+	return s.uploadsPrefix() + id + ".json"
+}
+
+func (s *S3Storage) segmentKey(id string, offset int64) string {
+	return fmt.Sprintf("%s%s/%020d", s.uploadsPrefix(), id, offset)
+}
+
+// StartUpload создаёт сессию загрузки файла name.
+func (s *S3Storage) StartUpload(ctx context.Context, name string, policy OverwritePolicy, ifMatch string) (*UploadSession, error) {
+	sess, err := s.newSession(name, policy, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.removeExpiredSessions(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.writeSession(ctx, &s3Session{UploadSession: *sess}); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// UploadStatus возвращает состояние сессии загрузки.
+func (s *S3Storage) UploadStatus(ctx context.Context, id string) (*UploadSession, error) {
+	sess, err := s.readSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &sess.UploadSession, nil
+}
+
+// WriteUpload сохраняет данные из r частью сессии, начинающейся со
+// смещения offset. Всё, что успели получить до ошибки чтения r, тоже
+// сохраняется, поэтому загрузка части доводится до конца и при отмене ctx.
+func (s *S3Storage) WriteUpload(ctx context.Context, id string, offset int64, r io.Reader) (*UploadSession, error) {
+	if !s.lockSession(id) {
+		return nil, &Error{Kind: ErrSessionBusy, Op: "upload", Name: id}
+	}
+	defer s.unlockSession(id)
+
+	sess, err := s.readSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != sess.Offset {
+		return nil, &Error{Kind: ErrOffsetMismatch, Op: "upload", Name: sess.Name, Offset: sess.Offset}
+	}
+
+	key := s.segmentKey(id, sess.Offset)
+	// Часть, сохранённая до сбоя без обновления состояния сессии,
+	// будет перезаписана, а её место в квоте освобождается.
+	if obj, err := s.client.HeadObject(ctx, key); err == nil {
+		s.release(obj.Size)
+	} else if !s3.IsNotFound(err) {
+		return nil, err
+	}
+
+	w := s.newWriter(context.WithoutCancel(ctx), key)
+	n, err := s.receive(ctx, w, r, sess.Name, sess.Offset, -1)
+	if n == 0 {
+		w.abort()
+		if err != nil {
+			return nil, err
+		}
+		return &sess.UploadSession, nil
+	}
+	// Полученное до ошибки тоже сохраняется.
+	if saveErr := w.Close(); saveErr != nil {
+		w.abort()
+		s.release(n)
+		return nil, errors.Join(err, saveErr)
+	}
+	sess.Parts = append(sess.Parts, n)
+	sess.Offset += n
+	sess.ExpiresAt = time.Now().Add(s.sessionTTL)
+	if saveErr := s.writeSession(context.WithoutCancel(ctx), sess); saveErr != nil {
+		return nil, errors.Join(err, saveErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sess.UploadSession, nil
+}
+
+// CommitUpload собирает файл из частей сессии, публикует его и удаляет
+// сессию. Если проверка или публикация не прошли, сессия остаётся.
+func (s *S3Storage) CommitUpload(ctx context.Context, id, expectedSHA256 string) (*FileInfo, error) {
+	if !s.lockSession(id) {
+		return nil, &Error{Kind: ErrSessionBusy, Op: "commit", Name: id}
+	}
+	defer s.unlockSession(id)
+
+	sess, err := s.readSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.sessionData(ctx, sess)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+
+	content, err := s.checkSession(&sess.UploadSession, expectedSHA256, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Единственная часть публикуется как есть, иначе части собираются
+	// во временный объект.
+	var src string
+	if len(sess.Parts) == 1 {
+		src = s.segmentKey(id, 0)
+	} else {
+		key, err := s.stagingKey()
+		if err != nil {
+			return nil, err
+		}
+		w := s.newWriter(ctx, key)
+		if _, err := io.Copy(w, io.NewSectionReader(data, 0, sess.Offset)); err != nil {
+			w.abort()
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			w.abort()
+			return nil, err
+		}
+		src = w.key
+	}
+
+	info, err := s.commit(ctx, src, sess.Name, content, sess.Overwrite, sess.IfMatch)
+	if err != nil {
+		if len(sess.Parts) != 1 {
+			s.client.DeleteObject(context.WithoutCancel(ctx), src)
+		}
+		return nil, err
+	}
+	// Данные сессии стали файлом, место в квоте остаётся занятым.
+	s.deleteSession(context.WithoutCancel(ctx), id)
+	return info, nil
+}
+
+// sessionData открывает части сессии для чтения как один файл.
+func (s *S3Storage) sessionData(ctx context.Context, sess *s3Session) (*segments, error) {
+	data := &segments{}
+	var offset int64
+	for _, size := range sess.Parts {
+		key := s.segmentKey(sess.ID, offset)
+		obj, err := s.client.HeadObject(ctx, key)
+		if err == nil && obj.Size != size {
+			err = fmt.Errorf("upload part %s: %d bytes, expected %d", key, obj.Size, size)
+		}
+		if err != nil {
+			data.Close()
+			return nil, err
+		}
+		data.offsets = append(data.offsets, offset)
+		data.parts = append(data.parts, s.newReader(ctx, sess.Name, obj))
+		offset += size
+	}
+	return data, nil
+}
+
+// segments - несколько объектов, читаемых подряд как один.
+type segments struct {
+	offsets []int64
+	parts   []*objectReader
+}
+
+func (d *segments) ReadAt(p []byte, off int64) (int, error) {
+	var n int
+	for len(p) > 0 {
+		// Последняя часть, начинающаяся не позже off.
+		i := sort.Search(len(d.offsets), func(i int) bool { return d.offsets[i] > off }) - 1
+		if i < 0 {
+			return n, io.EOF
+		}
+		m, err := d.parts[i].ReadAt(p, off-d.offsets[i])
+		n += m
+		p, off = p[m:], off+int64(m)
+		if err == io.EOF && i < len(d.parts)-1 {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (d *segments) Close() error {
+	for _, part := range d.parts {
+		part.Close()
+	}
+	return nil
+}
+
+func (s *S3Storage) readSession(ctx context.Context, id string) (*s3Session, error) {
+	notFound := &Error{Kind: ErrSessionNotFound, Op: "upload", Name: id}
+	if !validSessionID(id) {
+		return nil, notFound
+	}
+
+	body, _, err := s.client.GetObject(ctx, s.sessionKey(id), 0, 0, "")
+	if s3.IsNotFound(err) {
+		return nil, notFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var sess s3Session
+	if err := json.NewDecoder(body).Decode(&sess); err != nil {
+		return nil, err
+	}
+	if time.Now().After(sess.ExpiresAt) {
+		s.removeSession(ctx, id)
+		return nil, notFound
+	}
+	return &sess, nil
+}
+
+func (s *S3Storage) writeSession(ctx context.Context, sess *s3Session) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	return s.client.PutObject(ctx, s.sessionKey(sess.ID), data, "application/json", nil)
+}
+
+// removeSession удаляет сессию и освобождает место, которое занимали её части.
+func (s *S3Storage) removeSession(ctx context.Context, id string) error {
+	freed, err := s.deleteSession(ctx, id)
+	s.release(freed)
+	return err
+}
+
+// deleteSession удаляет состояние сессии и её части и возвращает их объём.
+func (s *S3Storage) deleteSession(ctx context.Context, id string) (int64, error) {
+	if err := s.client.DeleteObject(ctx, s.sessionKey(id)); err != nil {
+		return 0, err
+	}
+
+	var freed int64
+	opts := s3.ListOptions{Prefix: s.uploadsPrefix() + id + "/"}
+	for {
+		res, err := s.client.ListObjects(ctx, opts)
+		if err != nil {
+			return freed, err
+		}
+		for _, obj := range res.Objects {
+			if err := s.client.DeleteObject(ctx, obj.Key); err != nil {
+				return freed, err
+			}
+			freed += obj.Size
+		}
+		if res.NextContinuationToken == "" {
+			return freed, nil
+		}
+		opts.ContinuationToken = res.NextContinuationToken
+	}
+}
+
+// removeExpiredSessions удаляет просроченные сессии, части без сессии и
+// временные объекты прерванных загрузок. Состояние сессии перезаписывается
+// при каждой записи, поэтому срок жизни отсчитывается от его Last-Modified.
+func (s *S3Storage) removeExpiredSessions(ctx context.Context) error {
+	type session struct {
+		hasState bool
+		// active - время последнего изменения состояния или части.
+		active time.Time
+	}
+	sessions := make(map[string]*session)
+	var staging []string
+
+	now := time.Now()
+	opts := s3.ListOptions{Prefix: s.uploadsPrefix()}
+	for {
+		res, err := s.client.ListObjects(ctx, opts)
+		if err != nil {
+			return err
+		}
+		for _, obj := range res.Objects {
+			rest := strings.TrimPrefix(obj.Key, s.uploadsPrefix())
+			if strings.HasPrefix(rest, tmpPrefix) {
+				if now.Sub(obj.LastModified) > s.sessionTTL {
+					staging = append(staging, obj.Key)
+				}
+				continue
+			}
+
+			id, isState := strings.CutSuffix(rest, ".json")
+			if !isState {
+				id, _, _ = strings.Cut(rest, "/")
+			}
+			if !validSessionID(id) {
+				continue
+			}
+			sess := sessions[id]
+			if sess == nil {
+				sess = &session{}
+				sessions[id] = sess
+			}
+			if isState {
+				sess.hasState = true
+				sess.active = obj.LastModified
+			} else if !sess.hasState && obj.LastModified.After(sess.active) {
+				sess.active = obj.LastModified
+			}
+		}
+		if res.NextContinuationToken == "" {
+			break
+		}
+		opts.ContinuationToken = res.NextContinuationToken
+	}
+
+	for _, key := range staging {
+		if err := s.client.DeleteObject(ctx, key); err != nil {
+			return err
+		}
+	}
+	for id, sess := range sessions {
+		// Сессии, в которые сейчас пишут или которые публикуют, пропускаются.
+		if now.Sub(sess.active) <= s.sessionTTL || !s.lockSession(id) {
+			continue
+		}
+		err := s.removeSession(ctx, id)
+		s.unlockSession(id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// abortStaleUploads отменяет multipart-загрузки под префиксом хранилища,
+// начатые раньше срока жизни сессии: их оставил процесс, упавший
+// посреди Put или копирования. Части таких загрузок не видны в списке
+// объектов, но хранятся и оплачиваются, пока загрузку не отменят.
+func (s *S3Storage) abortStaleUploads(ctx context.Context) error {
+	uploads, err := s.client.ListMultipartUploads(ctx, s.prefix)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, up := range uploads {
+		if now.Sub(up.Initiated) <= s.sessionTTL {
+			continue
+		}
+		if err := s.client.AbortMultipartUpload(ctx, up.Key, up.UploadID); err != nil && !s3.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
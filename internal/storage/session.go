@@ -0,0 +1,325 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// uploadsDir - скрытый каталог с сессиями возобновляемых загрузок.
+// Для каждой сессии хранятся <id>.json с состоянием и <id>.part с данными.
+const uploadsDir = ".uploads"
+
+// DefaultUploadSessionTTL - сколько живёт сессия загрузки без активности.
+const DefaultUploadSessionTTL = 24 * time.Hour
+
+// UploadSession - состояние возобновляемой загрузки.
+type UploadSession struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Offset - сколько байт сохранено на диск. Следующая часть должна
+	// начинаться с этого смещения.
+	Offset int64 `json:"offset"`
+	// Overwrite и IfMatch применяются при CommitUpload.
+	Overwrite OverwritePolicy `json:"overwrite,omitempty"`
+	IfMatch   string          `json:"if_match,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// WithUploadSessionTTL задаёт время жизни сессии загрузки без активности.
+func WithUploadSessionTTL(d time.Duration) Option {
+	return func(b *base) {
+		if d > 0 {
+			b.sessionTTL = d
+		}
+	}
+}
+
+func (s *FileStorage) sessionPath(id, ext string) string {
+	return filepath.Join(s.storagePath, uploadsDir, id+ext)
+}
+
+// StartUpload создаёт сессию загрузки файла name. Политика перезаписи
+// проверяется при CommitUpload.
+func (s *FileStorage) StartUpload(ctx context.Context, name string, policy OverwritePolicy, ifMatch string) (*UploadSession, error) {
+	sess, err := s.newSession(name, policy, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.removeExpiredSessions(); err != nil {
+		return nil, err
+	}
+
+	part, err := os.OpenFile(s.sessionPath(sess.ID, ".part"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := part.Close(); err != nil {
+		return nil, err
+	}
+	if err := s.writeSession(sess); err != nil {
+		os.Remove(s.sessionPath(sess.ID, ".part"))
+		return nil, err
+	}
+	return sess, nil
+}
+
+// UploadStatus возвращает состояние сессии загрузки.
+func (s *FileStorage) UploadStatus(ctx context.Context, id string) (*UploadSession, error) {
+	return s.readSession(id)
+}
+
+// WriteUpload дописывает в сессию данные из r начиная со смещения offset.
+// Всё, что успели получить до ошибки чтения r, сохраняется, и клиент
+// может продолжить с нового смещения.
+func (s *FileStorage) WriteUpload(ctx context.Context, id string, offset int64, r io.Reader) (*UploadSession, error) {
+	if !s.lockSession(id) {
+		return nil, &Error{Kind: ErrSessionBusy, Op: "upload", Name: id}
+	}
+	defer s.unlockSession(id)
+
+	sess, err := s.readSession(id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != sess.Offset {
+		return nil, &Error{Kind: ErrOffsetMismatch, Op: "upload", Name: sess.Name, Offset: sess.Offset}
+	}
+
+	part, err := os.OpenFile(s.sessionPath(id, ".part"), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer part.Close()
+
+	// После падения сервера в .part могут остаться байты сверх
+	// сохранённого смещения, которые не успели попасть на диск целиком.
+	if stat, err := part.Stat(); err == nil && stat.Size() > sess.Offset {
+		if err := part.Truncate(sess.Offset); err != nil {
+			return nil, err
+		}
+		s.release(stat.Size() - sess.Offset)
+	}
+	if _, err := part.Seek(sess.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	n, err := s.receive(ctx, part, r, sess.Name, sess.Offset, -1)
+	if err != nil && n == 0 {
+		return nil, err
+	}
+	// Полученное до ошибки тоже сохраняется.
+	if saveErr := part.Sync(); saveErr != nil {
+		return nil, errors.Join(err, saveErr)
+	}
+	sess.Offset += n
+	sess.ExpiresAt = time.Now().Add(s.sessionTTL)
+	if saveErr := s.writeSession(sess); saveErr != nil {
+		return nil, errors.Join(err, saveErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// CommitUpload публикует файл, собранный в сессии, и удаляет сессию.
+// Если задан expectedSHA256 и он не совпадает с содержимым, файл не
+// публикуется, а сессия остаётся, чтобы клиент мог перезалить данные.
+func (s *FileStorage) CommitUpload(ctx context.Context, id, expectedSHA256 string) (*FileInfo, error) {
+	if !s.lockSession(id) {
+		return nil, &Error{Kind: ErrSessionBusy, Op: "commit", Name: id}
+	}
+	defer s.unlockSession(id)
+
+	sess, err := s.readSession(id)
+	if err != nil {
+		return nil, err
+	}
+
+	partPath := s.sessionPath(id, ".part")
+	part, err := os.Open(partPath)
+	if err != nil {
+		return nil, err
+	}
+	content, err := s.checkSession(sess, expectedSHA256, part)
+	part.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Truncate(partPath, sess.Offset); err != nil {
+		return nil, err
+	}
+
+	info, err := s.publish(partPath, sess.Name, content, sess.Overwrite, sess.IfMatch)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(s.sessionPath(id, ".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return info, nil
+}
+
+// newSession проверяет имя файла и описывает новую сессию его загрузки.
+func (s *base) newSession(name string, policy OverwritePolicy, ifMatch string) (*UploadSession, error) {
+	if err := s.names.Validate(name); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &UploadSession{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Overwrite: policy,
+		IfMatch:   ifMatch,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.sessionTTL),
+	}, nil
+}
+
+// checkSession проверяет собранные в сессии данные перед публикацией
+// и возвращает сведения о содержимом.
+func (s *base) checkSession(sess *UploadSession, expectedSHA256 string, data io.ReaderAt) (contentInfo, error) {
+	content, err := digest(io.NewSectionReader(data, 0, sess.Offset))
+	if err != nil {
+		return content, err
+	}
+	if err := checkDigest(sess.Name, expectedSHA256, content.SHA256); err != nil {
+		return content, err
+	}
+	if s.content.enabled() {
+		contentType, err := checkImageFile(s.content, sess.Name, io.NewSectionReader(data, 0, sess.Offset))
+		if err != nil {
+			return content, err
+		}
+		content.ContentType = contentType
+	}
+	return content, nil
+}
+
+func (s *base) lockSession(id string) bool {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+
+	if s.activeSessions[id] {
+		return false
+	}
+	s.activeSessions[id] = true
+	return true
+}
+
+func (s *base) unlockSession(id string) {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+
+	delete(s.activeSessions, id)
+}
+
+// validSessionID защищает от путей вместо идентификатора сессии.
+func validSessionID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+func (s *FileStorage) readSession(id string) (*UploadSession, error) {
+	notFound := &Error{Kind: ErrSessionNotFound, Op: "upload", Name: id}
+	if !validSessionID(id) {
+		return nil, notFound
+	}
+
+	data, err := os.ReadFile(s.sessionPath(id, ".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, notFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sess UploadSession
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, err
+	}
+	if time.Now().After(sess.ExpiresAt) {
+		s.removeSession(id)
+		return nil, notFound
+	}
+	return &sess, nil
+}
+
+func (s *FileStorage) writeSession(sess *UploadSession) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.sessionPath(sess.ID, ".json"), data)
+}
+
+func (s *FileStorage) removeSession(id string) {
+	os.Remove(s.sessionPath(id, ".json"))
+	s.removePart(id)
+}
+
+func (s *FileStorage) removePart(id string) {
+	path := s.sessionPath(id, ".part")
+	size := fileSize(path)
+	if os.Remove(path) == nil {
+		s.release(size)
+	}
+}
+
+// removeExpiredSessions удаляет просроченные сессии и файлы частей без сессии.
+// Сессии, в которые сейчас пишут или которые публикуют, пропускаются.
+func (s *FileStorage) removeExpiredSessions() error {
+	entries, err := os.ReadDir(filepath.Join(s.storagePath, uploadsDir))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, e := range entries {
+		id, ext, _ := strings.Cut(e.Name(), ".")
+		if !validSessionID(id) || !s.lockSession(id) {
+			continue
+		}
+
+		switch ext {
+		case "json":
+			// Срок читается под блокировкой сессии: WriteUpload мог его продлить.
+			data, err := os.ReadFile(s.sessionPath(id, ".json"))
+			if err != nil {
+				break
+			}
+			var sess UploadSession
+			if json.Unmarshal(data, &sess) != nil || now.After(sess.ExpiresAt) {
+				s.removeSession(id)
+			}
+		case "part":
+			if _, err := os.Stat(s.sessionPath(id, ".json")); errors.Is(err, os.ErrNotExist) {
+				// Часть без сессии - сессия была удалена или не успела сохраниться.
+				info, err := e.Info()
+				if err == nil && now.Sub(info.ModTime()) > s.sessionTTL {
+					s.removePart(id)
+				}
+			}
+		}
+		s.unlockSession(id)
+	}
+	return nil
+}
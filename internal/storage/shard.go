@@ -0,0 +1,322 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// shardLevels - глубина раскладки NewShardedFileStorage: 65536 каталогов
+// по 256 на уровень, при миллионах файлов в каждом остаются десятки.
+const shardLevels = 2
+
+// stagePrefix - префикс, под которым MigrateToSharded откладывает файлы,
+// чьё имя совпадает с именем каталога раскладки, например "2d".
+const stagePrefix = ".migrate-"
+
+// NewShardedFileStorage создаёт FileStorage, который раскладывает файлы
+// и их метаданные по подкаталогам ab/cd/ по первым байтам SHA-256 от имени,
+// чтобы ни в одном каталоге не скапливались миллионы записей. Для клиентов
+// хранилище не отличается от плоского. Каталог с файлами, загруженными
+// в плоской раскладке, переводится в эту командой migrate, см.
+// MigrateToSharded.
+func NewShardedFileStorage(path string, opts ...Option) (*FileStorage, error) {
+	if err := refuseDedup(path); err != nil {
+		return nil, err
+	}
+	flat, err := HasFlatFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	if flat {
+		return nil, fmt.Errorf("storage directory %s contains files in the flat layout, migrate it first", path)
+	}
+	return newFileStorage(path, shardLevels, opts)
+}
+
+// filePath - путь файла name в каталоге хранилища.
+func (s *FileStorage) filePath(name string) string {
+	return filepath.Join(s.storagePath, s.shard(name), name)
+}
+
+// shard - подкаталог файла name относительно корня раскладки, пустой
+// для плоской раскладки.
+func (s *FileStorage) shard(name string) string {
+	return shardOf(name, s.shards)
+}
+
+func shardOf(name string, levels int) string {
+	sum := sha256.Sum256([]byte(name))
+	dirs := make([]string, levels)
+	for i := range dirs {
+		dirs[i] = hex.EncodeToString(sum[i : i+1])
+	}
+	return filepath.Join(dirs...)
+}
+
+// isShard сообщает, может ли запись быть подкаталогом раскладки.
+func isShard(e os.DirEntry) bool {
+	return e.IsDir() && isShardName(e.Name())
+}
+
+func isShardName(name string) bool {
+	return len(name) == 2 && strings.Trim(name, "0123456789abcdef") == ""
+}
+
+// walkShards вызывает fn для каждого каталога раскладки с корнем root
+// и глубиной levels, где лежат записи. Остальные каталоги, в том числе
+// служебные, пропускаются. При levels = 0 fn вызывается для root.
+func walkShards(root string, levels int, fn func(dir string) error) error {
+	if levels == 0 {
+		return fn(root)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !isShard(e) {
+			continue
+		}
+		if err := walkShards(filepath.Join(root, e.Name()), levels-1, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containsEntry сообщает, есть ли в каталоге path запись, для которой
+// match возвращает true. Каталог читается только до первой такой записи.
+func containsEntry(path string, match func(os.DirEntry) bool) (bool, error) {
+	dir, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer dir.Close()
+
+	for {
+		entries, err := dir.ReadDir(1000)
+		for _, e := range entries {
+			if match(e) {
+				return true, nil
+			}
+		}
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// HasFlatFiles сообщает, остались ли в каталоге хранилища path файлы
+// в плоской раскладке, которые нужно перенести MigrateToSharded.
+func HasFlatFiles(path string) (bool, error) {
+	return containsEntry(path, isFlatFile)
+}
+
+// isFlatFile сообщает, является ли запись корня каталога хранилища
+// файлом в плоской раскладке, в том числе отложенным при переносе.
+func isFlatFile(e os.DirEntry) bool {
+	_, ok := flatName(e)
+	return ok
+}
+
+func flatName(e os.DirEntry) (string, bool) {
+	if !e.Type().IsRegular() {
+		return "", false
+	}
+	if name, ok := strings.CutPrefix(e.Name(), stagePrefix); ok {
+		return name, true
+	}
+	return e.Name(), !strings.HasPrefix(e.Name(), ".")
+}
+
+// MigrateToSharded переводит каталог хранилища path из плоской раскладки
+// в раскладку NewShardedFileStorage на месте и возвращает число
+// перенесённых файлов. Пока идёт перенос, сервер с этим каталогом
+// должен быть остановлен. Прерванный перенос можно запустить повторно:
+// он продолжится с оставшихся файлов. Сессии загрузки переносить не нужно.
+func MigrateToSharded(path string) (int, error) {
+	metaRoot := filepath.Join(path, metaDir)
+	if err := removeTemp(path); err != nil {
+		return 0, err
+	}
+	if err := removeTemp(metaRoot); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+
+	// Метаданные переносятся раньше файлов: если перенос прервётся
+	// между ними, файл останется в корне и будет перенесён при повторном
+	// запуске, а его метаданные уже будут на новом месте.
+	_, err := moveToShards(metaRoot, func(e os.DirEntry) (string, bool) {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		return name, ok && e.Type().IsRegular() && !isTemp(e.Name())
+	}, func(name string) string {
+		return filepath.Join(metaRoot, shardOf(name, shardLevels), name+".json")
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+
+	return moveToShards(path, flatName, func(name string) string {
+		return filepath.Join(path, shardOf(name, shardLevels), name)
+	})
+}
+
+// moveToShards переносит записи каталога root, для которых nameOf возвращает
+// имя файла, по путям dst. Существующие записи не перезаписываются.
+// Возвращает число перенесённых записей.
+//
+// Файл, чьё имя совпадает с именем каталога раскладки, мешает создать
+// этот каталог, поэтому сначала откладывается под stagePrefix и
+// переносится следующим проходом. Второй проход дешёвый: к этому времени
+// в root остаются только каталоги раскладки и отложенные файлы.
+func moveToShards(root string, nameOf func(os.DirEntry) (string, bool), dst func(name string) string) (int, error) {
+	m := &shardMove{root: root, nameOf: nameOf, dst: dst, touched: make(map[string]bool)}
+	for {
+		m.staged = 0
+		if err := m.pass(); err != nil {
+			return m.moved, err
+		}
+		if m.staged == 0 {
+			break
+		}
+	}
+
+	for dir := range m.touched {
+		if err := syncDir(dir); err != nil {
+			return m.moved, err
+		}
+	}
+	return m.moved, syncDir(root)
+}
+
+// shardMove - состояние moveToShards.
+type shardMove struct {
+	root    string
+	nameOf  func(os.DirEntry) (string, bool)
+	dst     func(name string) string
+	touched map[string]bool
+	moved   int
+	// staged - сколько файлов отложено за текущий проход.
+	staged int
+}
+
+// pass один раз читает root и переносит или откладывает найденные записи.
+func (m *shardMove) pass() error {
+	dir, err := os.Open(m.root)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	for {
+		// Перенесённые записи исчезают из root, а новые подкаталоги
+		// пропускаются, поэтому каталог можно читать по ходу переноса.
+		entries, readErr := dir.ReadDir(1000)
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+
+		for _, e := range entries {
+			name, ok := m.nameOf(e)
+			if !ok {
+				continue
+			}
+			var err error
+			if isShardName(e.Name()) {
+				err = m.stage(e.Name())
+			} else {
+				err = m.move(e.Name(), name)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if readErr == io.EOF {
+			return nil
+		}
+	}
+}
+
+// stage откладывает файл root под stagePrefix. Запись могла быть прочитана
+// до того, как файл отложили и на его месте создали каталог раскладки,
+// поэтому тип проверяется заново.
+func (m *shardMove) stage(entry string) error {
+	src := filepath.Join(m.root, entry)
+	info, err := os.Lstat(src)
+	if errors.Is(err, os.ErrNotExist) || err == nil && !info.Mode().IsRegular() {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(src, filepath.Join(m.root, stagePrefix+entry)); err != nil {
+		return err
+	}
+	m.staged++
+	return nil
+}
+
+// move переносит запись root с именем entry по пути dst(name).
+func (m *shardMove) move(entry, name string) error {
+	src, path := filepath.Join(m.root, entry), m.dst(name)
+	if err := m.mkdir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	// Жёсткая ссылка, в отличие от rename, не затирает запись,
+	// которая уже есть на новом месте.
+	err := os.Link(src, path)
+	if errors.Is(err, os.ErrExist) {
+		// Прошлый перенос мог прерваться между созданием ссылки
+		// и удалением старой записи.
+		if same, sameErr := sameFile(src, path); sameErr != nil || !same {
+			return errors.Join(fmt.Errorf("migrate %s: %s already exists", src, path), sameErr)
+		}
+	} else if err != nil {
+		return err
+	}
+	if err := os.Remove(src); err != nil {
+		return err
+	}
+	m.touched[filepath.Dir(path)] = true
+	m.moved++
+	return nil
+}
+
+// mkdir создаёт каталог раскладки dir. Если его место в root занимает
+// ещё не прочитанный файл с тем же именем, файл откладывается.
+func (m *shardMove) mkdir(dir string) error {
+	rel, err := filepath.Rel(m.root, dir)
+	if err != nil {
+		return err
+	}
+	top, _, _ := strings.Cut(rel, string(filepath.Separator))
+	if err := m.stage(top); err != nil {
+		return err
+	}
+	return os.MkdirAll(dir, os.ModePerm)
+}
+
+func sameFile(a, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(infoA, infoB), nil
+}
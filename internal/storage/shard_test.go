@@ -0,0 +1,149 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/krekio/TagesTest/internal/storage"
+)
+
+func TestMigrateToSharded(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	anyContent := storage.WithContentPolicy(storage.ContentPolicy{})
+
+	flat, err := storage.NewFileStorage(dir, anyContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SHA-256 от "x" начинается с 2d, поэтому файл "2d" занимает место
+	// каталога раскладки для "x". "ab" и "ff" - такие же имена без конфликта.
+	names := []string{"x", "2d", "ab", "ff", "photo.png", "a b.txt"}
+	want := make(map[string]*storage.FileInfo)
+	for _, name := range names {
+		info, err := flat.Put(ctx, storage.UploadHeader{Name: name, Size: -1}, bytes.NewReader([]byte("data of "+name)))
+		if err != nil {
+			t.Fatalf("Put(%s): %v", name, err)
+		}
+		want[name] = info
+	}
+	// Файл, загруженный до появления метаданных.
+	if err := os.WriteFile(filepath.Join(dir, "legacy.txt"), []byte("legacy"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sess, err := flat.StartUpload(ctx, "session.txt", storage.FailIfExists, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := flat.WriteUpload(ctx, sess.ID, 0, bytes.NewReader([]byte("resumable"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := storage.NewShardedFileStorage(dir, anyContent); err == nil {
+		t.Fatal("NewShardedFileStorage opened a flat directory")
+	}
+
+	moved, err := storage.MigrateToSharded(dir)
+	if err != nil {
+		t.Fatalf("MigrateToSharded: %v", err)
+	}
+	if moved != len(names)+1 {
+		t.Fatalf("moved %d files, want %d", moved, len(names)+1)
+	}
+	if moved, err := storage.MigrateToSharded(dir); err != nil || moved != 0 {
+		t.Fatalf("repeated MigrateToSharded: %d, %v", moved, err)
+	}
+
+	if _, err := storage.NewFileStorage(dir, anyContent); err == nil {
+		t.Fatal("NewFileStorage opened a sharded directory")
+	}
+	sharded, err := storage.NewShardedFileStorage(dir, anyContent)
+	if err != nil {
+		t.Fatalf("NewShardedFileStorage: %v", err)
+	}
+
+	for name, w := range want {
+		info, err := sharded.Stat(ctx, name)
+		if err != nil {
+			t.Fatalf("Stat(%s): %v", name, err)
+		}
+		if info.SHA256 != w.SHA256 || !info.CreatedAt.Equal(w.CreatedAt) {
+			t.Errorf("Stat(%s) = %+v, want %+v", name, info, w)
+		}
+	}
+	obj, err := sharded.Open(ctx, "legacy.txt")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	data, _ := io.ReadAll(io.NewSectionReader(obj, 0, obj.Info().Size))
+	obj.Close()
+	if string(data) != "legacy" {
+		t.Errorf("legacy.txt = %q", data)
+	}
+	if _, err := sharded.CommitUpload(ctx, sess.ID, ""); err != nil {
+		t.Fatalf("CommitUpload after migration: %v", err)
+	}
+
+	res, err := sharded.List(ctx, storage.ListOptions{PageSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Files) != len(names)+2 {
+		t.Errorf("List returned %d files, want %d", len(res.Files), len(names)+2)
+	}
+	var total int64
+	for _, f := range res.Files {
+		total += f.Size
+	}
+	if sharded.Usage() != total {
+		t.Errorf("Usage = %d, want %d", sharded.Usage(), total)
+	}
+}
+
+func TestMigrateToShardedResumes(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"x", "y"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := storage.MigrateToSharded(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Перенос прервался между созданием ссылки на новом месте и удалением
+	// файла из корня.
+	var moved string
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && d.Name() == "x" {
+			moved = path
+		}
+		return err
+	})
+	if err := os.Link(moved, filepath.Join(dir, "x")); err != nil {
+		t.Fatal(err)
+	}
+	// Прерванный перенос отложенного файла.
+	if err := os.WriteFile(filepath.Join(dir, ".migrate-2d"), []byte("2d"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.NewShardedFileStorage(dir); err == nil {
+		t.Fatal("NewShardedFileStorage opened a partially migrated directory")
+	}
+
+	if n, err := storage.MigrateToSharded(dir); err != nil || n != 2 {
+		t.Fatalf("resumed MigrateToSharded: %d, %v", n, err)
+	}
+
+	// Другой файл под уже перенесённым именем не затирается.
+	if err := os.WriteFile(filepath.Join(dir, "y"), []byte("other"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.MigrateToSharded(dir); err == nil {
+		t.Fatal("MigrateToSharded overwrote an existing file")
+	}
+}
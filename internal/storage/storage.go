@@ -1,108 +1,232 @@
 package storage
 
 import (
+	"context"
 	"errors"
-	"io"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
-
-	pb "github.com/krekio/TagesTest/protos"
 )
 
+// base - настройки и состояние, общие для всех реализаций хранилища.
+type base struct {
+	names      NamePolicy
+	content    ContentPolicy
+	quota      Quota
+	sessionTTL time.Duration
+	// listSortLimit - см. WithListSortLimit.
+	listSortLimit int
+
+	// used - занятый объём в байтах, см. quota.go.
+	usageMu sync.Mutex
+	used    int64
+
+	sessionsMu     sync.Mutex
+	activeSessions map[string]bool
+}
+
+type Option func(*base)
+
+func (b *base) init(opts []Option) {
+	b.names = DefaultNamePolicy()
+	b.sessionTTL = DefaultUploadSessionTTL
+	b.listSortLimit = DefaultListSortLimit
+	b.activeSessions = make(map[string]bool)
+	for _, opt := range opts {
+		opt(b)
+	}
+}
+
+// WithNamePolicy задаёт правила проверки имён файлов.
+func WithNamePolicy(p NamePolicy) Option {
+	return func(b *base) {
+		b.names = p
+	}
+}
+
 type FileStorage struct {
+	base
 	storagePath string
+	// shards - число уровней подкаталогов, по которым раскладываются
+	// файлы, 0 - все файлы прямо в storagePath, см. shard.go.
+	shards int
+	metaMu sync.RWMutex
+	// publish публикует проверенный временный файл под именем name,
+	// см. publishFile. DedupStorage подменяет его своей раскладкой.
+	publish func(tmpPath, name string, content contentInfo, policy OverwritePolicy, ifMatch string) (*FileInfo, error)
+}
+
+func NewFileStorage(path string, opts ...Option) (*FileStorage, error) {
+	if err := refuseDedup(path); err != nil {
+		return nil, err
+	}
+	// Иначе все файлы разложенного каталога оказались бы невидимыми.
+	sharded, err := containsEntry(path, isShard)
+	if err != nil {
+		return nil, err
+	}
+	if sharded {
+		return nil, fmt.Errorf("storage directory %s uses the sharded layout, set storage.layout to sharded or finish the migration", path)
+	}
+	return newFileStorage(path, 0, opts)
 }
 
-func NewFileStorage(path string) (*FileStorage, error) {
+func newFileStorage(path string, shards int, opts []Option) (*FileStorage, error) {
 	if _, err := os.Stat(path); err != nil {
 		if err = os.MkdirAll(path, os.ModePerm); err != nil {
 			return nil, err
 		}
 	}
+	for _, dir := range []string{metaDir, uploadsDir} {
+		if err := os.MkdirAll(filepath.Join(path, dir), os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	if err := removeTemp(path, filepath.Join(path, uploadsDir)); err != nil {
+		return nil, err
+	}
+	if err := walkShards(filepath.Join(path, metaDir), shards, func(dir string) error { return removeTemp(dir) }); err != nil {
+		return nil, err
+	}
 
-	return &FileStorage{storagePath: path}, nil
+	s := &FileStorage{storagePath: path, shards: shards}
+	s.init(opts)
+	s.publish = s.publishFile
+	if err := s.removeExpiredSessions(); err != nil {
+		return nil, err
+	}
+	if err := s.scanUsage(); err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
-func (s *FileStorage) Upload(stream pb.FileService_UploadFileServer) error {
-	var filename string
-	var file *os.File
+// DownloadOptions - параметры скачивания файла.
+type DownloadOptions struct {
+	// Offset и Length задают диапазон байт, Length = 0 - до конца файла.
+	Offset int64
+	Length int64
 
-	for {
-		req, err := stream.Recv()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
+	// IfNoneMatch и IfModifiedSince - условия скачивания, см. NotModified.
+	IfNoneMatch     string
+	IfModifiedSince time.Time
+}
 
-		if file == nil {
-			filename = filepath.Join(s.storagePath, req.GetFilename())
-			file, err = os.Create(filename)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
-		}
+// NotModified сообщает, можно ли не отправлять клиенту тело файла.
+// IfNoneMatch приоритетнее IfModifiedSince, как в HTTP.
+func (o *DownloadOptions) NotModified(info *FileInfo) bool {
+	if o.IfNoneMatch != "" {
+		return matchETag(o.IfNoneMatch, info.ETag())
+	}
+	if !o.IfModifiedSince.IsZero() {
+		// Даты в API передаются с точностью до секунды.
+		return !info.UpdatedAt.Truncate(time.Second).After(o.IfModifiedSince)
+	}
+	return false
+}
 
-		if _, err := file.Write(req.GetData()); err != nil {
-			return err
-		}
+// RangeLength проверяет диапазон [Offset, Offset+Length) для файла info
+// и возвращает его фактическую длину.
+func (o *DownloadOptions) RangeLength(info *FileInfo) (int64, error) {
+	size := info.Size
+	outOfRange := func(field, reason string) error {
+		return &Error{Kind: ErrOutOfRange, Op: "download", Name: info.Name, Field: field, Reason: reason, Limit: size}
 	}
 
-	return stream.SendAndClose(&pb.UploadFileResponse{Message: "Файл успешно загружен"})
+	switch {
+	case o.Offset < 0:
+		return 0, outOfRange("offset", "must not be negative")
+	case o.Length < 0:
+		return 0, outOfRange("length", "must not be negative")
+	case o.Offset > size:
+		return 0, outOfRange("offset", "is beyond the end of the file")
+	case o.Length > size-o.Offset:
+		return 0, outOfRange("length", "exceeds the end of the file")
+	case o.Length == 0:
+		return size - o.Offset, nil
+	}
+	return o.Length, nil
 }
 
-func (s *FileStorage) List() (*pb.ListFilesResponse, error) {
-	files, err := os.ReadDir(s.storagePath)
+// fileObject - открытый файл на диске.
+type fileObject struct {
+	*os.File
+	info *FileInfo
+}
+
+func (o *fileObject) Info() *FileInfo {
+	return o.info
+}
+
+// Open открывает файл для чтения.
+func (s *FileStorage) Open(ctx context.Context, filename string) (Object, error) {
+	if err := s.names.Validate(filename); err != nil {
+		return nil, err
+	}
+
+	file, info, err := s.open("download", filename)
 	if err != nil {
 		return nil, err
 	}
+	return &fileObject{File: file, info: info}, nil
+}
 
-	var fileInfos []*pb.FileInfo
-	for _, f := range files {
-		if f.IsDir() {
-			continue
+// open открывает файл и возвращает сведения именно об открытой версии.
+// op - операция для ошибки ErrNotFound.
+// Публикация файлов идёт через rename под s.metaMu, поэтому открытие
+// и чтение метаданных под s.metaMu.RLock дают согласованную пару.
+func (s *FileStorage) open(op, name string) (*os.File, *FileInfo, error) {
+	s.metaMu.RLock()
+	file, err := os.Open(s.filePath(name))
+	if err != nil {
+		s.metaMu.RUnlock()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, &Error{Kind: ErrNotFound, Op: op, Name: name}
 		}
+		return nil, nil, err
+	}
+	info, err := s.infoOf(file, name)
+	s.metaMu.RUnlock()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
 
-		filePath := filepath.Join(s.storagePath, f.Name())
-		fileStat, err := os.Stat(filePath)
-		if err != nil {
-			return nil, err
+	if info.SHA256 == "" {
+		// Файл загружен до появления сумм в метаданных: считаем по открытой
+		// версии, чтобы ETag соответствовал отправляемым данным.
+		if err := s.fillDigest(file, info); err != nil {
+			file.Close()
+			return nil, nil, err
 		}
+	}
+	return file, info, nil
+}
 
-		fileInfos = append(fileInfos, &pb.FileInfo{
-			Filename:  f.Name(),
-			CreatedAt: fileStat.ModTime().Format(time.RFC3339),
-			UpdatedAt: fileStat.ModTime().Format(time.RFC3339),
-		})
+// Delete удаляет файл вместе с его метаданными.
+func (s *FileStorage) Delete(ctx context.Context, filename string) error {
+	if err := s.names.Validate(filename); err != nil {
+		return err
 	}
 
-	return &pb.ListFilesResponse{Files: fileInfos}, nil
-}
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
 
-func (s *FileStorage) Download(filename string, stream pb.FileService_DownloadFileServer) error {
-	filePath := filepath.Join(s.storagePath, filename)
-	file, err := os.Open(filePath)
+	path := s.filePath(filename)
+	size := fileSize(path)
+	err := os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Error{Kind: ErrNotFound, Op: "delete", Name: filename}
+	}
 	if err != nil {
-		return errors.New("Ошибка скачивания файла")
+		return err
 	}
-	defer file.Close()
+	s.release(size)
 
-	buf := make([]byte, 1024)
-	for {
-		n, err := file.Read(buf)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
-
-		if err := stream.Send(&pb.DownloadFileResponse{Data: buf[:n]}); err != nil {
-			return err
-		}
+	if err := os.Remove(s.metaPath(filename)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
 	}
-	return nil
+	return syncDir(filepath.Dir(path))
 }
@@ -0,0 +1,215 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/krekio/TagesTest/internal/s3/s3test"
+	"github.com/krekio/TagesTest/internal/storage"
+	"github.com/krekio/TagesTest/internal/storage/storagetest"
+)
+
+// diskBackend оборачивает конструктор хранилища в каталоге для storagetest.
+func diskBackend[B storage.Backend](newStorage func(string, ...storage.Option) (B, error)) storagetest.Factory {
+	return func(t *testing.T, opts ...storage.Option) storage.Backend {
+		b, err := newStorage(t.TempDir(), opts...)
+		if err != nil {
+			t.Fatalf("new storage: %v", err)
+		}
+		return b
+	}
+}
+
+func TestFileStorage(t *testing.T) {
+	storagetest.Run(t, diskBackend(storage.NewFileStorage))
+}
+
+func TestShardedFileStorage(t *testing.T) {
+	storagetest.Run(t, diskBackend(storage.NewShardedFileStorage))
+}
+
+func TestDedupStorage(t *testing.T) {
+	storagetest.Run(t, diskBackend(storage.NewDedupStorage))
+}
+
+func TestLegacyDigestSaved(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	// Файл, загруженный до появления сумм в метаданных.
+	if err := os.WriteFile(filepath.Join(dir, "legacy.txt"), []byte("legacy"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := storage.NewFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := s.Open(ctx, "legacy.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(io.NewSectionReader(obj, 0, obj.Info().Size))
+	obj.Close()
+	if err != nil || string(data) != "legacy" {
+		t.Fatalf("read %q, %v", data, err)
+	}
+	sum := sha256.Sum256([]byte("legacy"))
+	if want := hex.EncodeToString(sum[:]); obj.Info().SHA256 != want {
+		t.Fatalf("SHA256 = %s, want %s", obj.Info().SHA256, want)
+	}
+
+	meta, err := os.ReadFile(filepath.Join(dir, ".meta", "legacy.txt.json"))
+	if err != nil {
+		t.Fatalf("digest not saved after Open: %v", err)
+	}
+	if !strings.Contains(string(meta), obj.Info().SHA256) {
+		t.Fatalf("metadata %s does not contain the digest", meta)
+	}
+}
+
+func TestListSortLimit(t *testing.T) {
+	ctx := context.Background()
+	for name, newStorage := range map[string]storagetest.Factory{
+		"flat":    diskBackend(storage.NewFileStorage),
+		"sharded": diskBackend(storage.NewShardedFileStorage),
+		"dedup":   diskBackend(storage.NewDedupStorage),
+		"s3": func(t *testing.T, opts ...storage.Option) storage.Backend {
+			srv := s3test.NewServer("bucket")
+			t.Cleanup(srv.Close)
+			s, err := storage.NewS3Storage(storage.S3Config{Config: srv.Config()}, opts...)
+			if err != nil {
+				t.Fatalf("NewS3Storage: %v", err)
+			}
+			return s
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			b := newStorage(t, storage.WithListSortLimit(2))
+			for _, name := range []string{"a1.txt", "a2.txt", "b1.txt"} {
+				if _, err := b.Put(ctx, storage.UploadHeader{Name: name, Size: -1}, strings.NewReader(name)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := b.List(ctx, storage.ListOptions{PageSize: 10, OrderBy: storage.OrderBySize})
+			if !errors.Is(err, storage.ErrInvalidArg) {
+				t.Fatalf("List by size over the limit: %v, want ErrInvalidArg", err)
+			}
+			if res, err := b.List(ctx, storage.ListOptions{PageSize: 10}); err != nil || len(res.Files) != 3 {
+				t.Fatalf("List by name: %v, %v", res, err)
+			}
+			res, err := b.List(ctx, storage.ListOptions{PageSize: 10, OrderBy: storage.OrderByCreated, NamePrefix: "a"})
+			if err != nil || len(res.Files) != 2 {
+				t.Fatalf("List by date with a prefix: %v, %v", res, err)
+			}
+
+			// S3 отдаёт ключи только по возрастанию, и убывающий порядок имён
+			// читает весь список.
+			res, err = b.List(ctx, storage.ListOptions{PageSize: 10, Descending: true})
+			if name == "s3" {
+				if !errors.Is(err, storage.ErrInvalidArg) {
+					t.Fatalf("List by name descending over the limit: %v, want ErrInvalidArg", err)
+				}
+			} else if err != nil || len(res.Files) != 3 {
+				t.Fatalf("List by name descending: %v, %v", res, err)
+			}
+		})
+	}
+}
+
+// Заголовок JPEG после большого блока EXIF, присланный по байту, должен
+// разбираться без повторного разбора начала файла на каждом байте.
+func TestContentPolicySmallWrites(t *testing.T) {
+	ctx := context.Background()
+	s, err := storage.NewFileStorage(t.TempDir(), storage.WithContentPolicy(storage.ContentPolicy{ImageFormats: []string{"png", "jpeg"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 2)), nil); err != nil {
+		t.Fatal(err)
+	}
+	exif := make([]byte, 60000)
+	app1 := append([]byte{0xff, 0xe1, byte((len(exif) + 2) >> 8), byte(len(exif) + 2)}, exif...)
+	img := slices.Concat(buf.Bytes()[:2], app1, buf.Bytes()[2:])
+
+	info, err := s.Put(ctx, storage.UploadHeader{Name: "photo.jpg", Size: -1}, iotest.OneByteReader(bytes.NewReader(img)))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if info.ContentType != "image/jpeg" {
+		t.Fatalf("ContentType = %q, want image/jpeg", info.ContentType)
+	}
+	_, err = s.Put(ctx, storage.UploadHeader{Name: "photo.png", Size: -1}, iotest.OneByteReader(bytes.NewReader(img)))
+	if !errors.Is(err, storage.ErrInvalidContent) {
+		t.Fatalf("Put with a mismatched extension: %v, want ErrInvalidContent", err)
+	}
+}
+
+// Файл, опубликованный до ошибки записи метаданных, остаётся в хранилище
+// и должен оставаться в квоте.
+func TestPutKeepsQuotaAfterPublish(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	s, err := storage.NewFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Метаданные не запишутся поверх каталога.
+	if err := os.MkdirAll(filepath.Join(dir, ".meta", "a.txt.json", "x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Put(ctx, storage.UploadHeader{Name: "a.txt", Size: -1}, strings.NewReader("hello")); err == nil {
+		t.Fatal("Put succeeded without metadata")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.txt")); err != nil {
+		t.Fatalf("file not published: %v", err)
+	}
+	if got := s.Usage(); got != 5 {
+		t.Fatalf("Usage = %d, want 5", got)
+	}
+}
+
+// Каталог одной раскладки не открывается хранилищем другой.
+func TestLayoutMismatch(t *testing.T) {
+	ctx := context.Background()
+	open := map[string]func(string) (storage.Backend, error){
+		"flat":    func(path string) (storage.Backend, error) { return storage.NewFileStorage(path) },
+		"sharded": func(path string) (storage.Backend, error) { return storage.NewShardedFileStorage(path) },
+		"dedup":   func(path string) (storage.Backend, error) { return storage.NewDedupStorage(path) },
+	}
+	for created, newStorage := range open {
+		dir := t.TempDir()
+		b, err := newStorage(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.Put(ctx, storage.UploadHeader{Name: "a.txt", Size: -1}, strings.NewReader("a")); err != nil {
+			t.Fatal(err)
+		}
+		for opened, newStorage := range open {
+			// Плоскую и разложенную раскладки различают NewFileStorage
+			// и NewShardedFileStorage, см. shard_test.go.
+			if opened == created || opened != "dedup" && created != "dedup" {
+				continue
+			}
+			if _, err := newStorage(dir); err == nil {
+				t.Errorf("%s storage opened a directory in the %s layout", opened, created)
+			}
+		}
+	}
+}
@@ -0,0 +1,652 @@
+// Package storagetest - набор проверок, который должна проходить каждая
+// реализация storage.Backend, чтобы сервер работал с ней так же, как
+// с хранилищем на диске.
+//
+// Использование в тестах реализации:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T, opts ...storage.Option) storage.Backend {
+//			return storage.NewMemoryStorage(opts...)
+//		})
+//	}
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krekio/TagesTest/internal/storage"
+)
+
+// Factory создаёт пустое хранилище с заданными настройками.
+type Factory func(t *testing.T, opts ...storage.Option) storage.Backend
+
+// Run запускает все проверки для реализации, которую создаёт newBackend.
+func Run(t *testing.T, newBackend Factory) {
+	tests := []struct {
+		name string
+		run  func(*testing.T, Factory)
+	}{
+		{"PutOpen", testPutOpen},
+		{"NotFound", testNotFound},
+		{"InvalidName", testInvalidName},
+		{"Timestamps", testTimestamps},
+		{"Overwrite", testOverwrite},
+		{"Checksums", testChecksums},
+		{"Delete", testDelete},
+		{"ListOrder", testListOrder},
+		{"ListFilters", testListFilters},
+		{"Walk", testWalk},
+		{"Quota", testQuota},
+		{"Sessions", testSessions},
+		{"SessionExpiresWhileWriting", testSessionExpiresWhileWriting},
+		{"ContentPolicy", testContentPolicy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newBackend)
+		})
+	}
+}
+
+func testPutOpen(t *testing.T, newBackend Factory) {
+	b := newBackend(t)
+	data := []byte("hello, world")
+
+	info := mustPut(t, b, storage.UploadHeader{Name: "a.txt", Size: int64(len(data))}, data)
+	if info.Name != "a.txt" || info.Size != int64(len(data)) || info.SHA256 != sum(data) {
+		t.Fatalf("Put returned %+v", info)
+	}
+	if info.ETag() != info.SHA256 {
+		t.Errorf("ETag = %q, want SHA-256 %q", info.ETag(), info.SHA256)
+	}
+	if !strings.HasPrefix(info.ContentType, "text/plain") {
+		t.Errorf("ContentType = %q, want text/plain", info.ContentType)
+	}
+
+	if got := mustRead(t, b, "a.txt"); !bytes.Equal(got, data) {
+		t.Errorf("read %q, want %q", got, data)
+	}
+	stat, err := b.Stat(context.Background(), "a.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if *stat != *info {
+		t.Errorf("Stat = %+v, Put returned %+v", stat, info)
+	}
+	if size, err := b.Size(context.Background(), "a.txt"); err != nil || size != info.Size {
+		t.Errorf("Size = %d, %v, want %d", size, err, info.Size)
+	}
+
+	// Заявленный тип содержимого сохраняется как есть.
+	info = mustPut(t, b, storage.UploadHeader{Name: "b.bin", Size: -1, ContentType: "application/x-test"}, data)
+	if info.ContentType != "application/x-test" {
+		t.Errorf("ContentType = %q, want the declared one", info.ContentType)
+	}
+
+	// Пустой файл - тоже файл.
+	info = mustPut(t, b, storage.UploadHeader{Name: "empty", Size: -1}, nil)
+	if info.Size != 0 {
+		t.Errorf("empty file size = %d", info.Size)
+	}
+	if got := mustRead(t, b, "empty"); len(got) != 0 {
+		t.Errorf("empty file read %q", got)
+	}
+}
+
+func testNotFound(t *testing.T, newBackend Factory) {
+	b := newBackend(t)
+	ctx := context.Background()
+
+	_, err := b.Open(ctx, "missing")
+	requireKind(t, err, storage.ErrNotFound)
+	_, err = b.Stat(ctx, "missing")
+	requireKind(t, err, storage.ErrNotFound)
+	_, err = b.Size(ctx, "missing")
+	requireKind(t, err, storage.ErrNotFound)
+	requireKind(t, b.Delete(ctx, "missing"), storage.ErrNotFound)
+}
+
+func testInvalidName(t *testing.T, newBackend Factory) {
+	b := newBackend(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"", ".", "..", "../x", "a/b", ".hidden", "nul"} {
+		_, err := put(b, storage.UploadHeader{Name: name, Size: -1}, []byte("x"))
+		requireKind(t, err, storage.ErrInvalidName)
+		_, err = b.Open(ctx, name)
+		requireKind(t, err, storage.ErrInvalidName)
+		_, err = b.StartUpload(ctx, name, storage.Overwrite, "")
+		requireKind(t, err, storage.ErrInvalidName)
+	}
+}
+
+func testTimestamps(t *testing.T, newBackend Factory) {
+	b := newBackend(t)
+
+	before := time.Now().Add(-time.Second)
+	first := mustPut(t, b, storage.UploadHeader{Name: "a.txt", Size: -1}, []byte("one"))
+	if first.CreatedAt.Before(before) || !first.UpdatedAt.Equal(first.CreatedAt) {
+		t.Fatalf("new file: created %v, updated %v", first.CreatedAt, first.UpdatedAt)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	second := mustPut(t, b, storage.UploadHeader{Name: "a.txt", Size: -1}, []byte("two"))
+	if !second.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("overwrite changed CreatedAt: %v -> %v", first.CreatedAt, second.CreatedAt)
+	}
+	if !second.UpdatedAt.After(first.UpdatedAt) {
+		t.Errorf("overwrite did not advance UpdatedAt: %v -> %v", first.UpdatedAt, second.UpdatedAt)
+	}
+}
+
+func testOverwrite(t *testing.T, newBackend Factory) {
+	b := newBackend(t)
+	orig := mustPut(t, b, storage.UploadHeader{Name: "a.txt", Size: -1}, []byte("orig"))
+
+	_, err := put(b, storage.UploadHeader{Name: "a.txt", Size: -1, Overwrite: storage.FailIfExists}, []byte("new"))
+	requireKind(t, err, storage.ErrAlreadyExists)
+	mustPut(t, b, storage.UploadHeader{Name: "b.txt", Size: -1, Overwrite: storage.FailIfExists}, []byte("new"))
+
+	for _, want := range []string{"a (1).txt", "a (2).txt"} {
+		info := mustPut(t, b, storage.UploadHeader{Name: "a.txt", Size: -1, Overwrite: storage.AutoRename}, []byte("copy"))
+		if info.Name != want {
+			t.Errorf("AutoRename saved as %q, want %q", info.Name, want)
+		}
+	}
+
+	_, err = put(b, storage.UploadHeader{Name: "a.txt", Size: -1, Overwrite: storage.IfMatch, IfMatch: sum([]byte("other"))}, []byte("x"))
+	requireKind(t, err, storage.ErrPreconditionFailed)
+	_, err = put(b, storage.UploadHeader{Name: "c.txt", Size: -1, Overwrite: storage.IfMatch, IfMatch: "*"}, []byte("x"))
+	requireKind(t, err, storage.ErrPreconditionFailed)
+	mustPut(t, b, storage.UploadHeader{Name: "a.txt", Size: -1, Overwrite: storage.IfMatch, IfMatch: `"` + orig.ETag() + `"`}, []byte("matched"))
+
+	if got := mustRead(t, b, "a.txt"); string(got) != "matched" {
+		t.Errorf("a.txt = %q after failed and matched overwrites", got)
+	}
+	if got := mustRead(t, b, "a (1).txt"); string(got) != "copy" {
+		t.Errorf("a (1).txt = %q", got)
+	}
+}
+
+func testChecksums(t *testing.T, newBackend Factory) {
+	b := newBackend(t)
+	ctx := context.Background()
+	data := []byte("payload")
+
+	_, err := put(b, storage.UploadHeader{Name: "a.txt", Size: -1, SHA256: sum([]byte("other"))}, data)
+	requireKind(t, err, storage.ErrChecksumMismatch)
+	_, err = put(b, storage.UploadHeader{Name: "a.txt", Size: int64(len(data)) + 1}, data)
+	requireKind(t, err, storage.ErrInvalidArg)
+	_, err = put(b, storage.UploadHeader{Name: "a.txt", Size: int64(len(data)) - 1}, data)
+	requireKind(t, err, storage.ErrInvalidArg)
+	_, err = b.Stat(ctx, "a.txt")
+	requireKind(t, err, storage.ErrNotFound)
+
+	mustPut(t, b, storage.UploadHeader{Name: "a.txt", Size: int64(len(data)), SHA256: strings.ToUpper(sum(data))}, data)
+
+	// Ошибка потока прерывает загрузку, файл не появляется.
+	broken := io.MultiReader(bytes.NewReader(data), errReader{})
+	_, err = b.Put(ctx, storage.UploadHeader{Name: "broken.txt", Size: -1}, broken)
+	if !errors.Is(err, errBroken) {
+		t.Errorf("Put with a broken stream: %v, want %v", err, errBroken)
+	}
+	_, err = b.Stat(ctx, "broken.txt")
+	requireKind(t, err, storage.ErrNotFound)
+}
+
+func testDelete(t *testing.T, newBackend Factory) {
+	b := newBackend(t)
+	ctx := context.Background()
+
+	mustPut(t, b, storage.UploadHeader{Name: "a.txt", Size: -1}, []byte("a"))
+	if err := b.Delete(ctx, "a.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	_, err := b.Open(ctx, "a.txt")
+	requireKind(t, err, storage.ErrNotFound)
+
+	// После удаления имя свободно, а дата создания новая.
+	time.Sleep(10 * time.Millisecond)
+	first := time.Now().Add(-5 * time.Millisecond)
+	info := mustPut(t, b, storage.UploadHeader{Name: "a.txt", Size: -1, Overwrite: storage.FailIfExists}, []byte("b"))
+	if info.CreatedAt.Before(first) {
+		t.Errorf("re-created file kept the old CreatedAt %v", info.CreatedAt)
+	}
+}
+
+func testListOrder(t *testing.T, newBackend Factory) {
+	b := newBackend(t)
+	ctx := context.Background()
+
+	// Загружаются не по порядку имён, размеры повторяются.
+	for _, f := range []struct {
+		name string
+		size int
+	}{{"c", 3}, {"a", 1}, {"e", 3}, {"b", 2}, {"d", 5}} {
+		mustPut(t, b, storage.UploadHeader{Name: f.name, Size: -1}, bytes.Repeat([]byte("x"), f.size))
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	tests := []struct {
+		order storage.OrderBy
+		desc  bool
+		want  []string
+	}{
+		{storage.OrderByName, false, []string{"a", "b", "c", "d", "e"}},
+		{storage.OrderByName, true, []string{"e", "d", "c", "b", "a"}},
+		{storage.OrderByCreated, false, []string{"c", "a", "e", "b", "d"}},
+		{storage.OrderByUpdated, true, []string{"d", "b", "e", "a", "c"}},
+		{storage.OrderBySize, false, []string{"a", "b", "c", "e", "d"}},
+		{storage.OrderBySize, true, []string{"d", "e", "c", "b", "a"}},
+	}
+	for _, tt := range tests {
+		for _, pageSize := range []int{1, 2, 5, 10} {
+			opts := storage.ListOptions{PageSize: pageSize, OrderBy: tt.order, Descending: tt.desc}
+			if got := listAll(t, b, opts); !slices.Equal(got, tt.want) {
+				t.Errorf("order %d desc %v page %d: %v, want %v", tt.order, tt.desc, pageSize, got, tt.want)
+			}
+		}
+	}
+
+	// Токен привязан к параметрам запроса.
+	res, err := b.List(ctx, storage.ListOptions{PageSize: 1})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	_, err = b.List(ctx, storage.ListOptions{PageSize: 1, PageToken: res.NextPageToken, OrderBy: storage.OrderBySize})
+	requireKind(t, err, storage.ErrInvalidArg)
+	_, err = b.List(ctx, storage.ListOptions{PageSize: 1, PageToken: "garbage"})
+	requireKind(t, err, storage.ErrInvalidArg)
+	_, err = b.List(ctx, storage.ListOptions{})
+	requireKind(t, err, storage.ErrInvalidArg)
+
+	// Удаление между страницами не приводит к повторам и пропускам.
+	if err := b.Delete(ctx, "a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	res, err = b.List(ctx, storage.ListOptions{PageSize: 2, PageToken: res.NextPageToken})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if got := names(res.Files); !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("second page after delete: %v, want [b c]", got)
+	}
+}
+
+func testListFilters(t *testing.T, newBackend Factory) {
+	b := newBackend(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"img1.png", "img2.jpg", "doc.txt", "img3.png"} {
+		mustPut(t, b, storage.UploadHeader{Name: name, Size: -1}, []byte(name))
+	}
+	mid := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	mustPut(t, b, storage.UploadHeader{Name: "img4.png", Size: -1}, []byte("late"))
+
+	tests := []struct {
+		opts storage.ListOptions
+		want []string
+	}{
+		{storage.ListOptions{NamePrefix: "img"}, []string{"img1.png", "img2.jpg", "img3.png", "img4.png"}},
+		{storage.ListOptions{NameGlob: "*.png"}, []string{"img1.png", "img3.png", "img4.png"}},
+		{storage.ListOptions{NamePrefix: "img", NameGlob: "*.jpg"}, []string{"img2.jpg"}},
+		{storage.ListOptions{CreatedAfter: mid}, []string{"img4.png"}},
+		{storage.ListOptions{UpdatedBefore: mid, NameGlob: "*.png"}, []string{"img1.png", "img3.png"}},
+	}
+	for _, tt := range tests {
+		tt.opts.PageSize = 2
+		if got := listAll(t, b, tt.opts); !slices.Equal(got, tt.want) {
+			t.Errorf("List(%+v) = %v, want %v", tt.opts, got, tt.want)
+		}
+	}
+
+	_, err := b.List(ctx, storage.ListOptions{PageSize: 1, NameGlob: "["})
+	requireKind(t, err, storage.ErrInvalidArg)
+}
+
+func testWalk(t *testing.T, newBackend Factory) {
+	b := newBackend(t)
+	ctx := context.Background()
+
+	var want []string
+	for i := range 7 {
+		name := string(rune('a'+i)) + ".txt"
+		mustPut(t, b, storage.UploadHeader{Name: name, Size: -1}, []byte(name))
+		want = append(want, name)
+	}
+	mustPut(t, b, storage.UploadHeader{Name: "other.bin", Size: -1}, []byte("x"))
+
+	var got []string
+	err := b.Walk(ctx, storage.WalkOptions{BatchSize: 3, NameGlob: "*.txt"}, func(files []*storage.FileInfo) error {
+		if len(files) == 0 || len(files) > 3 {
+			t.Errorf("batch of %d files", len(files))
+		}
+		for _, f := range files {
+			if f.Size != int64(len(f.Name)) || f.SHA256 == "" {
+				t.Errorf("walk info %+v", f)
+			}
+		}
+		got = append(got, names(files)...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	// Порядок обхода не гарантируется.
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("Walk visited %v, want %v", got, want)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = b.Walk(ctx, storage.WalkOptions{BatchSize: 1}, func([]*storage.FileInfo) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("Walk after fn error: %v, %d calls", err, calls)
+	}
+
+	requireKind(t, b.Walk(ctx, storage.WalkOptions{}, nil), storage.ErrInvalidArg)
+}
+
+func testQuota(t *testing.T, newBackend Factory) {
+	b := newBackend(t, storage.WithQuota(storage.Quota{MaxFileSize: 10, MaxTotalSize: 25}))
+	ctx := context.Background()
+	// Содержимое файлов различается, чтобы хранилища с дедупликацией
+	// учитывали каждый файл отдельно.
+	var seq byte
+	unique := func(n int) []byte {
+		seq++
+		return bytes.Repeat([]byte{seq}, n)
+	}
+
+	_, err := put(b, storage.UploadHeader{Name: "big", Size: 11}, nil)
+	requireKind(t, err, storage.ErrTooLarge)
+	_, err = put(b, storage.UploadHeader{Name: "big", Size: -1}, unique(11))
+	requireKind(t, err, storage.ErrTooLarge)
+
+	mustPut(t, b, storage.UploadHeader{Name: "a", Size: -1}, unique(10))
+	mustPut(t, b, storage.UploadHeader{Name: "b", Size: -1}, unique(10))
+	_, err = put(b, storage.UploadHeader{Name: "c", Size: -1}, unique(10))
+	requireKind(t, err, storage.ErrQuotaExceeded)
+	_, err = put(b, storage.UploadHeader{Name: "c", Size: 10}, nil)
+	requireKind(t, err, storage.ErrQuotaExceeded)
+
+	// Отклонённые загрузки не занимают место.
+	mustPut(t, b, storage.UploadHeader{Name: "c", Size: -1}, unique(5))
+
+	// Удаление и перезапись меньшим файлом освобождают место.
+	if err := b.Delete(ctx, "a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	mustPut(t, b, storage.UploadHeader{Name: "b", Size: -1}, unique(1))
+	mustPut(t, b, storage.UploadHeader{Name: "d", Size: -1}, unique(10))
+	mustPut(t, b, storage.UploadHeader{Name: "e", Size: -1}, unique(9))
+	_, err = put(b, storage.UploadHeader{Name: "f", Size: -1}, unique(1))
+	requireKind(t, err, storage.ErrQuotaExceeded)
+
+	// Данные сессий тоже учитываются.
+	if err := b.Delete(ctx, "d"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	sess, err := b.StartUpload(ctx, "g", storage.Overwrite, "")
+	if err != nil {
+		t.Fatalf("StartUpload: %v", err)
+	}
+	_, err = b.WriteUpload(ctx, sess.ID, 0, bytes.NewReader(unique(11)))
+	requireKind(t, err, storage.ErrTooLarge)
+	if _, err := b.WriteUpload(ctx, sess.ID, 0, bytes.NewReader(unique(8))); err != nil {
+		t.Fatalf("WriteUpload: %v", err)
+	}
+	_, err = put(b, storage.UploadHeader{Name: "f", Size: -1}, unique(3))
+	requireKind(t, err, storage.ErrQuotaExceeded)
+	if _, err := b.CommitUpload(ctx, sess.ID, ""); err != nil {
+		t.Fatalf("CommitUpload: %v", err)
+	}
+	_, err = put(b, storage.UploadHeader{Name: "f", Size: -1}, unique(3))
+	requireKind(t, err, storage.ErrQuotaExceeded)
+	mustPut(t, b, storage.UploadHeader{Name: "f", Size: -1}, unique(2))
+}
+
+func testSessions(t *testing.T, newBackend Factory) {
+	b := newBackend(t)
+	ctx := context.Background()
+
+	mustPut(t, b, storage.UploadHeader{Name: "taken.txt", Size: -1}, []byte("old"))
+	sess, err := b.StartUpload(ctx, "taken.txt", storage.AutoRename, "")
+	if err != nil {
+		t.Fatalf("StartUpload: %v", err)
+	}
+	if sess.Offset != 0 || sess.Name != "taken.txt" || !sess.ExpiresAt.After(time.Now()) {
+		t.Fatalf("new session %+v", sess)
+	}
+
+	status, err := b.WriteUpload(ctx, sess.ID, 0, strings.NewReader("hello "))
+	if err != nil || status.Offset != 6 {
+		t.Fatalf("WriteUpload: %+v, %v", status, err)
+	}
+	_, err = b.WriteUpload(ctx, sess.ID, 0, strings.NewReader("again"))
+	requireKind(t, err, storage.ErrOffsetMismatch)
+
+	// Данные, полученные до обрыва потока, сохраняются.
+	broken := io.MultiReader(strings.NewReader("wor"), errReader{})
+	if _, err := b.WriteUpload(ctx, sess.ID, 6, broken); !errors.Is(err, errBroken) {
+		t.Fatalf("WriteUpload with a broken stream: %v, want %v", err, errBroken)
+	}
+	status, err = b.UploadStatus(ctx, sess.ID)
+	if err != nil || status.Offset != 9 {
+		t.Fatalf("UploadStatus after a broken stream: %+v, %v", status, err)
+	}
+	if _, err := b.WriteUpload(ctx, sess.ID, 9, strings.NewReader("ld")); err != nil {
+		t.Fatalf("WriteUpload: %v", err)
+	}
+
+	// До публикации файла нет, неверная сумма сессию не удаляет.
+	_, err = b.Stat(ctx, "taken (1).txt")
+	requireKind(t, err, storage.ErrNotFound)
+	_, err = b.CommitUpload(ctx, sess.ID, sum([]byte("other")))
+	requireKind(t, err, storage.ErrChecksumMismatch)
+
+	info, err := b.CommitUpload(ctx, sess.ID, sum([]byte("hello world")))
+	if err != nil {
+		t.Fatalf("CommitUpload: %v", err)
+	}
+	if info.Name != "taken (1).txt" || info.Size != 11 || info.SHA256 != sum([]byte("hello world")) {
+		t.Errorf("committed %+v", info)
+	}
+	if got := mustRead(t, b, info.Name); string(got) != "hello world" {
+		t.Errorf("committed file = %q", got)
+	}
+	if got := mustRead(t, b, "taken.txt"); string(got) != "old" {
+		t.Errorf("AutoRename session overwrote the original: %q", got)
+	}
+
+	_, err = b.UploadStatus(ctx, sess.ID)
+	requireKind(t, err, storage.ErrSessionNotFound)
+	_, err = b.CommitUpload(ctx, sess.ID, "")
+	requireKind(t, err, storage.ErrSessionNotFound)
+	_, err = b.WriteUpload(ctx, "0123456789abcdef0123456789abcdef", 0, strings.NewReader("x"))
+	requireKind(t, err, storage.ErrSessionNotFound)
+	_, err = b.UploadStatus(ctx, "../../etc/passwd")
+	requireKind(t, err, storage.ErrSessionNotFound)
+
+	expiring := newBackend(t, storage.WithUploadSessionTTL(time.Millisecond))
+	sess, err = expiring.StartUpload(ctx, "late.txt", storage.Overwrite, "")
+	if err != nil {
+		t.Fatalf("StartUpload: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	_, err = expiring.UploadStatus(ctx, sess.ID)
+	requireKind(t, err, storage.ErrSessionNotFound)
+}
+
+// Сессия, срок которой вышел посреди WriteUpload, не удаляется, пока
+// в неё пишут: запись продлевает срок.
+func testSessionExpiresWhileWriting(t *testing.T, newBackend Factory) {
+	const ttl = 100 * time.Millisecond
+	b := newBackend(t, storage.WithUploadSessionTTL(ttl))
+	ctx := context.Background()
+
+	sess, err := b.StartUpload(ctx, "slow.txt", storage.Overwrite, "")
+	if err != nil {
+		t.Fatalf("StartUpload: %v", err)
+	}
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.WriteUpload(ctx, sess.ID, 0, pr)
+		done <- err
+	}()
+	// Запись возвращается, только когда WriteUpload прочитал данные.
+	if _, err := pw.Write([]byte("hello, ")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * ttl)
+	// StartUpload удаляет просроченные сессии.
+	if _, err := b.StartUpload(ctx, "other.txt", storage.Overwrite, ""); err != nil {
+		t.Fatalf("StartUpload: %v", err)
+	}
+	if _, err := pw.Write([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("WriteUpload: %v", err)
+	}
+
+	if _, err := b.CommitUpload(ctx, sess.ID, ""); err != nil {
+		t.Fatalf("CommitUpload: %v", err)
+	}
+	if got := mustRead(t, b, "slow.txt"); string(got) != "hello, world" {
+		t.Fatalf("read %q, want %q", got, "hello, world")
+	}
+}
+
+func testContentPolicy(t *testing.T, newBackend Factory) {
+	b := newBackend(t, storage.WithContentPolicy(storage.ContentPolicy{ImageFormats: []string{"png"}}))
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	img := buf.Bytes()
+
+	info := mustPut(t, b, storage.UploadHeader{Name: "a.png", Size: -1}, img)
+	if info.ContentType != "image/png" {
+		t.Errorf("ContentType = %q, want image/png", info.ContentType)
+	}
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"a.txt", img},
+		{"b.png", []byte("definitely not an image")},
+		{"c.png", nil},
+	} {
+		_, err := put(b, storage.UploadHeader{Name: tt.name, Size: -1}, tt.data)
+		requireKind(t, err, storage.ErrInvalidContent)
+	}
+
+	sess, err := b.StartUpload(ctx, "d.png", storage.Overwrite, "")
+	if err != nil {
+		t.Fatalf("StartUpload: %v", err)
+	}
+	if _, err := b.WriteUpload(ctx, sess.ID, 0, strings.NewReader("plain text")); err != nil {
+		t.Fatalf("WriteUpload: %v", err)
+	}
+	_, err = b.CommitUpload(ctx, sess.ID, "")
+	requireKind(t, err, storage.ErrInvalidContent)
+}
+
+var errBroken = errors.New("storagetest: broken stream")
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errBroken
+}
+
+func put(b storage.Backend, hdr storage.UploadHeader, data []byte) (*storage.FileInfo, error) {
+	return b.Put(context.Background(), hdr, bytes.NewReader(data))
+}
+
+func mustPut(t *testing.T, b storage.Backend, hdr storage.UploadHeader, data []byte) *storage.FileInfo {
+	t.Helper()
+	info, err := put(b, hdr, data)
+	if err != nil {
+		t.Fatalf("Put(%q): %v", hdr.Name, err)
+	}
+	return info
+}
+
+func mustRead(t *testing.T, b storage.Backend, name string) []byte {
+	t.Helper()
+	obj, err := b.Open(context.Background(), name)
+	if err != nil {
+		t.Fatalf("Open(%q): %v", name, err)
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(io.NewSectionReader(obj, 0, obj.Info().Size))
+	if err != nil {
+		t.Fatalf("read %q: %v", name, err)
+	}
+	if got := sum(data); got != obj.Info().SHA256 {
+		t.Errorf("%q: content SHA-256 %s, info says %s", name, got, obj.Info().SHA256)
+	}
+	return data
+}
+
+func listAll(t *testing.T, b storage.Backend, opts storage.ListOptions) []string {
+	t.Helper()
+	var all []string
+	for {
+		res, err := b.List(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("List(%+v): %v", opts, err)
+		}
+		if len(res.Files) > opts.PageSize {
+			t.Fatalf("page of %d files, page size %d", len(res.Files), opts.PageSize)
+		}
+		all = append(all, names(res.Files)...)
+		if res.NextPageToken == "" {
+			return all
+		}
+		opts.PageToken = res.NextPageToken
+	}
+}
+
+func names(files []*storage.FileInfo) []string {
+	var out []string
+	for _, f := range files {
+		out = append(out, f.Name)
+	}
+	return out
+}
+
+func sum(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func requireKind(t *testing.T, err, kind error) {
+	t.Helper()
+	if !errors.Is(err, kind) {
+		t.Errorf("got error %v, want %v", err, kind)
+	}
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tmpPrefix - префикс временных файлов незавершённых загрузок и метаданных.
+const tmpPrefix = ".tmp-"
+
+func isTemp(name string) bool {
+	return strings.HasPrefix(name, tmpPrefix)
+}
+
+// removeTemp удаляет временные файлы, оставшиеся после аварийного
+// завершения сервера посреди загрузки.
+func removeTemp(dirs ...string) error {
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.IsDir() || !isTemp(e.Name()) {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// syncDir сбрасывает на диск содержимое каталога, чтобы переименование
+// файла пережило падение системы.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// writeFileAtomic записывает файл через временный файл в том же каталоге,
+// чтобы читатели видели либо старое, либо новое содержимое целиком.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), tmpPrefix+"meta-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	// Без Sync после сбоя под именем path может оказаться пустой файл.
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// UploadHeader - параметры загружаемого файла.
+type UploadHeader struct {
+	Name string
+	// Size - заявленный размер, -1 если неизвестен.
+	Size int64
+	// ContentType - заявленный MIME-тип, пустой - определить по содержимому.
+	ContentType string
+	// SHA256 - ожидаемая сумма содержимого в hex, пустая - не проверять.
+	SHA256 string
+	// Overwrite - что делать с существующим файлом, IfMatch - ожидаемый
+	// ETag для политики IfMatch.
+	Overwrite OverwritePolicy
+	IfMatch   string
+}
+
+// Chunk - часть загружаемого файла.
+type Chunk struct {
+	Data []byte
+	// CRC32C - контрольная сумма Data, nil если клиент её не передал.
+	CRC32C *uint32
+}
+
+// uploadBufferSize - сколько байт читается из потока загрузки за раз.
+const uploadBufferSize = 32 << 10
+
+// Put сохраняет файл с содержимым из r. Данные пишутся во временный
+// файл в каталоге хранилища и переименовываются в итоговое имя только
+// после получения всех данных и проверки размера и суммы, поэтому
+// читатели никогда не видят недокачанный файл. Размер проверяется по
+// заявленному заранее и по полученным данным по мере приёма, см. Quota.
+func (s *FileStorage) Put(ctx context.Context, hdr UploadHeader, r io.Reader) (info *FileInfo, err error) {
+	up, err := s.startUpload(hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(s.storagePath, tmpPrefix+"upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			if !isPublished(err) {
+				up.abort()
+			}
+		}
+	}()
+	// CreateTemp создаёт файл с правами 0600, а os.Create раньше давал 0666.
+	if err := tmp.Chmod(0o644); err != nil {
+		return nil, err
+	}
+
+	if err := up.receive(ctx, tmp, r); err != nil {
+		return nil, err
+	}
+	content, err := up.finish()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	return s.publish(tmp.Name(), hdr.Name, content, hdr.Overwrite, hdr.IfMatch)
+}
+
+// upload - проверки загружаемого файла, общие для всех реализаций
+// хранилища: размер, квота, тип содержимого и контрольная сумма.
+type upload struct {
+	s       *base
+	hdr     UploadHeader
+	content *digester
+	sniffer *imageSniffer
+	// reserved - место в квоте, занятое полученными данными.
+	reserved int64
+}
+
+// startUpload проверяет заголовок до приёма данных.
+func (s *base) startUpload(hdr UploadHeader) (*upload, error) {
+	if err := s.names.Validate(hdr.Name); err != nil {
+		return nil, err
+	}
+	if hdr.Size >= 0 {
+		if err := s.checkFileSize("upload", hdr.Name, hdr.Size); err != nil {
+			return nil, err
+		}
+		if err := s.checkFree("upload", hdr.Name, hdr.Size); err != nil {
+			return nil, err
+		}
+	}
+
+	up := &upload{s: s, hdr: hdr, content: newDigester()}
+	if s.content.enabled() {
+		up.sniffer = &imageSniffer{policy: s.content, name: hdr.Name, declared: hdr.ContentType}
+	}
+	return up, nil
+}
+
+// receive копирует r в w, по мере приёма проверяя размер и содержимое.
+func (u *upload) receive(ctx context.Context, w io.Writer, r io.Reader) error {
+	dst := io.MultiWriter(w, u.content)
+	if u.sniffer != nil {
+		// Проверка идёт первой, чтобы неподходящие данные не попали в хранилище.
+		dst = io.MultiWriter(u.sniffer, w, u.content)
+	}
+	n, err := u.s.receive(ctx, dst, r, u.hdr.Name, 0, u.hdr.Size)
+	u.reserved += n
+	return err
+}
+
+// finish завершает проверки, когда все данные получены, и возвращает
+// сведения о содержимом.
+func (u *upload) finish() (contentInfo, error) {
+	result := u.content.info()
+	if u.hdr.Size >= 0 && result.Size != u.hdr.Size {
+		return result, sizeMismatch(u.hdr.Name, u.hdr.Size, result.Size)
+	}
+	if u.sniffer != nil {
+		if err := u.sniffer.finish(); err != nil {
+			return result, err
+		}
+		result.ContentType = u.sniffer.contentType
+	}
+	if err := checkDigest(u.hdr.Name, u.hdr.SHA256, result.SHA256); err != nil {
+		return result, err
+	}
+	if u.hdr.ContentType != "" {
+		result.ContentType = u.hdr.ContentType
+	}
+	return result, nil
+}
+
+// abort освобождает место в квоте, если файл так и не был сохранён.
+func (u *upload) abort() {
+	u.s.release(u.reserved)
+	u.reserved = 0
+}
+
+// publishedError - ошибка после публикации файла: файл уже виден
+// читателям, поэтому место в квоте за ним не освобождается.
+type publishedError struct {
+	error
+}
+
+func (e *publishedError) Unwrap() error {
+	return e.error
+}
+
+// afterPublish помечает ошибку шага, выполняемого после публикации файла.
+func afterPublish(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &publishedError{err}
+}
+
+func isPublished(err error) bool {
+	var e *publishedError
+	return errors.As(err, &e)
+}
+
+// receive копирует r в w, проверяя отмену ctx, размер файла и квоту.
+// offset - сколько байт файла уже получено, declared - заявленный размер
+// файла или -1. Возвращает число записанных в w байт; место под них
+// остаётся занятым в квоте и при ошибке.
+func (s *base) receive(ctx context.Context, w io.Writer, r io.Reader, name string, offset, declared int64) (int64, error) {
+	var written int64
+	buf := make([]byte, uploadBufferSize)
+	for {
+		n, readErr := r.Read(buf)
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		if n > 0 {
+			size := offset + written + int64(n)
+			if declared >= 0 && size > declared {
+				return written, sizeMismatch(name, declared, size)
+			}
+			if err := s.checkFileSize("upload", name, size); err != nil {
+				return written, err
+			}
+			if err := s.reserve("upload", name, int64(n)); err != nil {
+				return written, err
+			}
+			m, err := w.Write(buf[:n])
+			written += int64(m)
+			if err != nil {
+				s.release(int64(n - m))
+				return written, err
+			}
+		}
+
+		if readErr == io.EOF {
+			return written, nil
+		}
+		if readErr != nil {
+			return written, readErr
+		}
+	}
+}
+
+func sizeMismatch(name string, declared, got int64) error {
+	return &Error{Kind: ErrInvalidArg, Op: "upload", Name: name, Field: "size",
+		Reason: fmt.Sprintf("received %d bytes, declared %d", got, declared)}
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+)
+
+// WalkOptions - параметры обхода хранилища.
+type WalkOptions struct {
+	BatchSize  int
+	NamePrefix string
+	// NameGlob - шаблон имени в синтаксисе path.Match.
+	NameGlob string
+}
+
+// filter проверяет параметры обхода и возвращает фильтр имён.
+func (o *WalkOptions) filter() (*ListOptions, error) {
+	if o.BatchSize <= 0 {
+		return nil, &Error{Kind: ErrInvalidArg, Op: "walk", Field: "batch_size", Reason: "must be positive"}
+	}
+	if o.NameGlob != "" {
+		if _, err := path.Match(o.NameGlob, ""); err != nil {
+			return nil, &Error{Kind: ErrInvalidArg, Op: "walk", Field: "name_glob", Reason: err.Error()}
+		}
+	}
+	return &ListOptions{NamePrefix: o.NamePrefix, NameGlob: o.NameGlob}, nil
+}
+
+// Walk обходит хранилище, читая каталог порциями, и передаёт fn сведения
+// о файлах пачками не больше opts.BatchSize. Память не зависит от числа
+// файлов в хранилище. Порядок файлов - порядок чтения каталога.
+// Обход прекращается при отмене ctx или ошибке fn.
+func (s *FileStorage) Walk(ctx context.Context, opts WalkOptions, fn func([]*FileInfo) error) error {
+	return s.index().walk(ctx, opts, fn)
+}
+
+func (d dirIndex) walk(ctx context.Context, opts WalkOptions, fn func([]*FileInfo) error) error {
+	filter, err := opts.filter()
+	if err != nil {
+		return err
+	}
+
+	batch := make([]*FileInfo, 0, opts.BatchSize)
+	err = walkShards(d.dir, d.levels, func(dir string) error {
+		return d.walkDir(ctx, dir, filter, opts.BatchSize, &batch, fn)
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
+
+// walkDir читает каталог dir порциями и дополняет batch. Заполненные
+// пачки передаются fn, неполная остаётся в batch для следующего каталога.
+func (d dirIndex) walkDir(ctx context.Context, path string, filter *ListOptions, size int, batch *[]*FileInfo, fn func([]*FileInfo) error) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		entries, readErr := dir.ReadDir(size)
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+
+		for _, e := range entries {
+			name, ok := d.name(e)
+			if !ok || !filter.matchName(name) {
+				continue
+			}
+
+			info, err := d.info(name)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			*batch = append(*batch, info)
+			if len(*batch) == size {
+				if err := fn(*batch); err != nil {
+					return err
+				}
+				*batch = make([]*FileInfo, 0, size)
+			}
+		}
+
+		if readErr == io.EOF {
+			return nil
+		}
+	}
+}
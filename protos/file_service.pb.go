@@ -21,29 +21,985 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type UploadHeader_OverwritePolicy int32
+
+const (
+	// Заменить существующий файл.
+	UploadHeader_OVERWRITE UploadHeader_OverwritePolicy = 0
+	// Отклонить загрузку с ALREADY_EXISTS, если файл уже есть.
+	UploadHeader_FAIL_IF_EXISTS UploadHeader_OverwritePolicy = 1
+	// Сохранить под свободным именем вида "foo (1).png".
+	UploadHeader_AUTO_RENAME UploadHeader_OverwritePolicy = 2
+	// Заменить файл, только если его ETag совпадает с if_match,
+	// иначе FAILED_PRECONDITION.
+	UploadHeader_IF_MATCH UploadHeader_OverwritePolicy = 3
+)
+
+// Enum value maps for UploadHeader_OverwritePolicy.
+var (
+	UploadHeader_OverwritePolicy_name = map[int32]string{
+		0: "OVERWRITE",
+		1: "FAIL_IF_EXISTS",
+		2: "AUTO_RENAME",
+		3: "IF_MATCH",
+	}
+	UploadHeader_OverwritePolicy_value = map[string]int32{
+		"OVERWRITE":      0,
+		"FAIL_IF_EXISTS": 1,
+		"AUTO_RENAME":    2,
+		"IF_MATCH":       3,
+	}
+)
+
+func (x UploadHeader_OverwritePolicy) Enum() *UploadHeader_OverwritePolicy {
+	p := new(UploadHeader_OverwritePolicy)
+	*p = x
+	return p
+}
+
+func (x UploadHeader_OverwritePolicy) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (UploadHeader_OverwritePolicy) Descriptor() protoreflect.EnumDescriptor {
+	return file_protos_file_service_proto_enumTypes[0].Descriptor()
+}
+
+func (UploadHeader_OverwritePolicy) Type() protoreflect.EnumType {
+	return &file_protos_file_service_proto_enumTypes[0]
+}
+
+func (x UploadHeader_OverwritePolicy) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use UploadHeader_OverwritePolicy.Descriptor instead.
+func (UploadHeader_OverwritePolicy) EnumDescriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{1, 0}
+}
+
+type ListFilesRequest_OrderBy int32
+
+const (
+	ListFilesRequest_NAME    ListFilesRequest_OrderBy = 0
+	ListFilesRequest_CREATED ListFilesRequest_OrderBy = 1
+	ListFilesRequest_UPDATED ListFilesRequest_OrderBy = 2
+	ListFilesRequest_SIZE    ListFilesRequest_OrderBy = 3
+)
+
+// Enum value maps for ListFilesRequest_OrderBy.
+var (
+	ListFilesRequest_OrderBy_name = map[int32]string{
+		0: "NAME",
+		1: "CREATED",
+		2: "UPDATED",
+		3: "SIZE",
+	}
+	ListFilesRequest_OrderBy_value = map[string]int32{
+		"NAME":    0,
+		"CREATED": 1,
+		"UPDATED": 2,
+		"SIZE":    3,
+	}
+)
+
+func (x ListFilesRequest_OrderBy) Enum() *ListFilesRequest_OrderBy {
+	p := new(ListFilesRequest_OrderBy)
+	*p = x
+	return p
+}
+
+func (x ListFilesRequest_OrderBy) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ListFilesRequest_OrderBy) Descriptor() protoreflect.EnumDescriptor {
+	return file_protos_file_service_proto_enumTypes[1].Descriptor()
+}
+
+func (ListFilesRequest_OrderBy) Type() protoreflect.EnumType {
+	return &file_protos_file_service_proto_enumTypes[1]
+}
+
+func (x ListFilesRequest_OrderBy) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ListFilesRequest_OrderBy.Descriptor instead.
+func (ListFilesRequest_OrderBy) EnumDescriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{4, 0}
+}
+
 type UploadFileRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Filename string                 `protobuf:"bytes,1,opt,name=filename,proto3" json:"filename,omitempty"`
+	Data     []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	// Если задан, данные дописываются в сессию возобновляемой загрузки,
+	// а filename не используется.
+	SessionId string `protobuf:"bytes,3,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	// Смещение data в файле. Должно совпадать с committed_offset сессии.
+	Offset int64 `protobuf:"varint,4,opt,name=offset,proto3" json:"offset,omitempty"`
+	// Ожидаемый SHA-256 всего файла в hex, учитывается из первого сообщения.
+	// При несовпадении загрузка отклоняется с DATA_LOSS и файл не появляется.
+	Sha256 string `protobuf:"bytes,5,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	// CRC32C (Castagnoli) поля data этого сообщения.
+	Crc32C        *uint32 `protobuf:"varint,6,opt,name=crc32c,proto3,oneof" json:"crc32c,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadFileRequest) Reset() {
+	*x = UploadFileRequest{}
+	mi := &file_protos_file_service_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadFileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadFileRequest) ProtoMessage() {}
+
+func (x *UploadFileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadFileRequest.ProtoReflect.Descriptor instead.
+func (*UploadFileRequest) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *UploadFileRequest) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *UploadFileRequest) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *UploadFileRequest) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *UploadFileRequest) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *UploadFileRequest) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *UploadFileRequest) GetCrc32C() uint32 {
+	if x != nil && x.Crc32C != nil {
+		return *x.Crc32C
+	}
+	return 0
+}
+
+type UploadHeader struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Filename string                 `protobuf:"bytes,1,opt,name=filename,proto3" json:"filename,omitempty"`
+	// Заявленный размер файла. Если задан, загрузка с другим количеством
+	// байт отклоняется.
+	Size *int64 `protobuf:"varint,2,opt,name=size,proto3,oneof" json:"size,omitempty"`
+	// MIME-тип содержимого. Если не задан, определяется по первым байтам.
+	ContentType string `protobuf:"bytes,3,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	// Ожидаемый SHA-256 всего файла в hex.
+	Sha256    string                       `protobuf:"bytes,4,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	Overwrite UploadHeader_OverwritePolicy `protobuf:"varint,5,opt,name=overwrite,proto3,enum=proto.UploadHeader_OverwritePolicy" json:"overwrite,omitempty"`
+	// ETag (SHA-256 в hex) заменяемого файла для политики IF_MATCH.
+	IfMatch       string `protobuf:"bytes,6,opt,name=if_match,json=ifMatch,proto3" json:"if_match,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadHeader) Reset() {
+	*x = UploadHeader{}
+	mi := &file_protos_file_service_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadHeader) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadHeader) ProtoMessage() {}
+
+func (x *UploadHeader) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadHeader.ProtoReflect.Descriptor instead.
+func (*UploadHeader) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *UploadHeader) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *UploadHeader) GetSize() int64 {
+	if x != nil && x.Size != nil {
+		return *x.Size
+	}
+	return 0
+}
+
+func (x *UploadHeader) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *UploadHeader) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *UploadHeader) GetOverwrite() UploadHeader_OverwritePolicy {
+	if x != nil {
+		return x.Overwrite
+	}
+	return UploadHeader_OVERWRITE
+}
+
+func (x *UploadHeader) GetIfMatch() string {
+	if x != nil {
+		return x.IfMatch
+	}
+	return ""
+}
+
+type UploadFileV2Request struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*UploadFileV2Request_Header
+	//	*UploadFileV2Request_Chunk
+	Payload isUploadFileV2Request_Payload `protobuf_oneof:"payload"`
+	// CRC32C (Castagnoli) поля chunk этого сообщения.
+	Crc32C        *uint32 `protobuf:"varint,3,opt,name=crc32c,proto3,oneof" json:"crc32c,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadFileV2Request) Reset() {
+	*x = UploadFileV2Request{}
+	mi := &file_protos_file_service_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadFileV2Request) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadFileV2Request) ProtoMessage() {}
+
+func (x *UploadFileV2Request) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadFileV2Request.ProtoReflect.Descriptor instead.
+func (*UploadFileV2Request) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *UploadFileV2Request) GetPayload() isUploadFileV2Request_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *UploadFileV2Request) GetHeader() *UploadHeader {
+	if x != nil {
+		if x, ok := x.Payload.(*UploadFileV2Request_Header); ok {
+			return x.Header
+		}
+	}
+	return nil
+}
+
+func (x *UploadFileV2Request) GetChunk() []byte {
+	if x != nil {
+		if x, ok := x.Payload.(*UploadFileV2Request_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+func (x *UploadFileV2Request) GetCrc32C() uint32 {
+	if x != nil && x.Crc32C != nil {
+		return *x.Crc32C
+	}
+	return 0
+}
+
+type isUploadFileV2Request_Payload interface {
+	isUploadFileV2Request_Payload()
+}
+
+type UploadFileV2Request_Header struct {
+	Header *UploadHeader `protobuf:"bytes,1,opt,name=header,proto3,oneof"`
+}
+
+type UploadFileV2Request_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*UploadFileV2Request_Header) isUploadFileV2Request_Payload() {}
+
+func (*UploadFileV2Request_Chunk) isUploadFileV2Request_Payload() {}
+
+type UploadFileResponse struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Message string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	// Для загрузки в сессию - сколько байт сохранено после этого стрима.
+	CommittedOffset int64 `protobuf:"varint,2,opt,name=committed_offset,json=committedOffset,proto3" json:"committed_offset,omitempty"`
+	// SHA-256 сохранённого файла в hex.
+	Sha256 string `protobuf:"bytes,3,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	// Имя, под которым сохранён файл. Отличается от запрошенного при AUTO_RENAME.
+	Filename      string `protobuf:"bytes,4,opt,name=filename,proto3" json:"filename,omitempty"`
+	Etag          string `protobuf:"bytes,5,opt,name=etag,proto3" json:"etag,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadFileResponse) Reset() {
+	*x = UploadFileResponse{}
+	mi := &file_protos_file_service_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadFileResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadFileResponse) ProtoMessage() {}
+
+func (x *UploadFileResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadFileResponse.ProtoReflect.Descriptor instead.
+func (*UploadFileResponse) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *UploadFileResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *UploadFileResponse) GetCommittedOffset() int64 {
+	if x != nil {
+		return x.CommittedOffset
+	}
+	return 0
+}
+
+func (x *UploadFileResponse) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *UploadFileResponse) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *UploadFileResponse) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+type ListFilesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Размер страницы, 0 - значение по умолчанию сервера.
+	PageSize int32 `protobuf:"varint,1,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	// next_page_token из предыдущего ответа. Остальные параметры запроса
+	// должны совпадать с запросом, вернувшим токен.
+	PageToken  string                   `protobuf:"bytes,2,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	OrderBy    ListFilesRequest_OrderBy `protobuf:"varint,3,opt,name=order_by,json=orderBy,proto3,enum=proto.ListFilesRequest_OrderBy" json:"order_by,omitempty"`
+	Descending bool                     `protobuf:"varint,4,opt,name=descending,proto3" json:"descending,omitempty"`
+	NamePrefix string                   `protobuf:"bytes,5,opt,name=name_prefix,json=namePrefix,proto3" json:"name_prefix,omitempty"`
+	// Шаблон имени в синтаксисе path.Match, например "*.png".
+	NameGlob string `protobuf:"bytes,6,opt,name=name_glob,json=nameGlob,proto3" json:"name_glob,omitempty"`
+	// Границы дат в RFC 3339: after - включительно, before - не включая.
+	CreatedAfter  string `protobuf:"bytes,7,opt,name=created_after,json=createdAfter,proto3" json:"created_after,omitempty"`
+	CreatedBefore string `protobuf:"bytes,8,opt,name=created_before,json=createdBefore,proto3" json:"created_before,omitempty"`
+	UpdatedAfter  string `protobuf:"bytes,9,opt,name=updated_after,json=updatedAfter,proto3" json:"updated_after,omitempty"`
+	UpdatedBefore string `protobuf:"bytes,10,opt,name=updated_before,json=updatedBefore,proto3" json:"updated_before,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListFilesRequest) Reset() {
+	*x = ListFilesRequest{}
+	mi := &file_protos_file_service_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFilesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFilesRequest) ProtoMessage() {}
+
+func (x *ListFilesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFilesRequest.ProtoReflect.Descriptor instead.
+func (*ListFilesRequest) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListFilesRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *ListFilesRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+func (x *ListFilesRequest) GetOrderBy() ListFilesRequest_OrderBy {
+	if x != nil {
+		return x.OrderBy
+	}
+	return ListFilesRequest_NAME
+}
+
+func (x *ListFilesRequest) GetDescending() bool {
+	if x != nil {
+		return x.Descending
+	}
+	return false
+}
+
+func (x *ListFilesRequest) GetNamePrefix() string {
+	if x != nil {
+		return x.NamePrefix
+	}
+	return ""
+}
+
+func (x *ListFilesRequest) GetNameGlob() string {
+	if x != nil {
+		return x.NameGlob
+	}
+	return ""
+}
+
+func (x *ListFilesRequest) GetCreatedAfter() string {
+	if x != nil {
+		return x.CreatedAfter
+	}
+	return ""
+}
+
+func (x *ListFilesRequest) GetCreatedBefore() string {
+	if x != nil {
+		return x.CreatedBefore
+	}
+	return ""
+}
+
+func (x *ListFilesRequest) GetUpdatedAfter() string {
+	if x != nil {
+		return x.UpdatedAfter
+	}
+	return ""
+}
+
+func (x *ListFilesRequest) GetUpdatedBefore() string {
+	if x != nil {
+		return x.UpdatedBefore
+	}
+	return ""
+}
+
+type ListFilesResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Files []*FileInfo            `protobuf:"bytes,1,rep,name=files,proto3" json:"files,omitempty"`
+	// Пустой токен означает последнюю страницу.
+	NextPageToken string `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListFilesResponse) Reset() {
+	*x = ListFilesResponse{}
+	mi := &file_protos_file_service_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFilesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFilesResponse) ProtoMessage() {}
+
+func (x *ListFilesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFilesResponse.ProtoReflect.Descriptor instead.
+func (*ListFilesResponse) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListFilesResponse) GetFiles() []*FileInfo {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+func (x *ListFilesResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+type FileInfo struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Filename  string                 `protobuf:"bytes,1,opt,name=filename,proto3" json:"filename,omitempty"`
+	CreatedAt string                 `protobuf:"bytes,2,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt string                 `protobuf:"bytes,3,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	Size      int64                  `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	// SHA-256 содержимого в hex.
+	Sha256      string `protobuf:"bytes,5,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	ContentType string `protobuf:"bytes,6,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	// Строгий ETag - SHA-256 содержимого в hex. Пустой, если сумма ещё не
+	// посчитана (файлы, загруженные до её появления); GetFileInfo считает её.
+	Etag          string `protobuf:"bytes,7,opt,name=etag,proto3" json:"etag,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileInfo) Reset() {
+	*x = FileInfo{}
+	mi := &file_protos_file_service_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileInfo) ProtoMessage() {}
+
+func (x *FileInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileInfo.ProtoReflect.Descriptor instead.
+func (*FileInfo) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *FileInfo) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *FileInfo) GetCreatedAt() string {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return ""
+}
+
+func (x *FileInfo) GetUpdatedAt() string {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return ""
+}
+
+func (x *FileInfo) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *FileInfo) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *FileInfo) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *FileInfo) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+type DownloadFileRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Filename string                 `protobuf:"bytes,1,opt,name=filename,proto3" json:"filename,omitempty"`
+	// Диапазон байт файла: с offset, length байт. length = 0 - до конца файла.
+	Offset int64 `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	Length int64 `protobuf:"varint,3,opt,name=length,proto3" json:"length,omitempty"`
+	// Условное скачивание: если ETag файла совпадает с if_none_match или файл
+	// не менялся после if_modified_since (RFC 3339), тело не отправляется,
+	// а единственное сообщение ответа содержит not_modified = true.
+	// if_none_match приоритетнее if_modified_since.
+	IfNoneMatch     string `protobuf:"bytes,4,opt,name=if_none_match,json=ifNoneMatch,proto3" json:"if_none_match,omitempty"`
+	IfModifiedSince string `protobuf:"bytes,5,opt,name=if_modified_since,json=ifModifiedSince,proto3" json:"if_modified_since,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *DownloadFileRequest) Reset() {
+	*x = DownloadFileRequest{}
+	mi := &file_protos_file_service_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DownloadFileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DownloadFileRequest) ProtoMessage() {}
+
+func (x *DownloadFileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DownloadFileRequest.ProtoReflect.Descriptor instead.
+func (*DownloadFileRequest) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DownloadFileRequest) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *DownloadFileRequest) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *DownloadFileRequest) GetLength() int64 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
+func (x *DownloadFileRequest) GetIfNoneMatch() string {
+	if x != nil {
+		return x.IfNoneMatch
+	}
+	return ""
+}
+
+func (x *DownloadFileRequest) GetIfModifiedSince() string {
+	if x != nil {
+		return x.IfModifiedSince
+	}
+	return ""
+}
+
+type DownloadFileResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Data  []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	// Полный размер файла, заполняется только в первом сообщении.
+	TotalSize     int64 `protobuf:"varint,2,opt,name=total_size,json=totalSize,proto3" json:"total_size,omitempty"`
+	NotModified   bool  `protobuf:"varint,3,opt,name=not_modified,json=notModified,proto3" json:"not_modified,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DownloadFileResponse) Reset() {
+	*x = DownloadFileResponse{}
+	mi := &file_protos_file_service_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DownloadFileResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DownloadFileResponse) ProtoMessage() {}
+
+func (x *DownloadFileResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DownloadFileResponse.ProtoReflect.Descriptor instead.
+func (*DownloadFileResponse) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DownloadFileResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *DownloadFileResponse) GetTotalSize() int64 {
+	if x != nil {
+		return x.TotalSize
+	}
+	return 0
+}
+
+func (x *DownloadFileResponse) GetNotModified() bool {
+	if x != nil {
+		return x.NotModified
+	}
+	return false
+}
+
+type DeleteFileRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Filename      string                 `protobuf:"bytes,1,opt,name=filename,proto3" json:"filename,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteFileRequest) Reset() {
+	*x = DeleteFileRequest{}
+	mi := &file_protos_file_service_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteFileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteFileRequest) ProtoMessage() {}
+
+func (x *DeleteFileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteFileRequest.ProtoReflect.Descriptor instead.
+func (*DeleteFileRequest) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *DeleteFileRequest) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+type DeleteFileResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteFileResponse) Reset() {
+	*x = DeleteFileResponse{}
+	mi := &file_protos_file_service_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteFileResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteFileResponse) ProtoMessage() {}
+
+func (x *DeleteFileResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteFileResponse.ProtoReflect.Descriptor instead.
+func (*DeleteFileResponse) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *DeleteFileResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type GetFileInfoRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Filename      string                 `protobuf:"bytes,1,opt,name=filename,proto3" json:"filename,omitempty"`
-	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *UploadFileRequest) Reset() {
-	*x = UploadFileRequest{}
-	mi := &file_protos_file_service_proto_msgTypes[0]
+func (x *GetFileInfoRequest) Reset() {
+	*x = GetFileInfoRequest{}
+	mi := &file_protos_file_service_proto_msgTypes[11]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *UploadFileRequest) String() string {
+func (x *GetFileInfoRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*UploadFileRequest) ProtoMessage() {}
+func (*GetFileInfoRequest) ProtoMessage() {}
 
-func (x *UploadFileRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_file_service_proto_msgTypes[0]
+func (x *GetFileInfoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[11]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -54,47 +1010,88 @@ func (x *UploadFileRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use UploadFileRequest.ProtoReflect.Descriptor instead.
-func (*UploadFileRequest) Descriptor() ([]byte, []int) {
-	return file_protos_file_service_proto_rawDescGZIP(), []int{0}
+// Deprecated: Use GetFileInfoRequest.ProtoReflect.Descriptor instead.
+func (*GetFileInfoRequest) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{11}
 }
 
-func (x *UploadFileRequest) GetFilename() string {
+func (x *GetFileInfoRequest) GetFilename() string {
 	if x != nil {
 		return x.Filename
 	}
 	return ""
 }
 
-func (x *UploadFileRequest) GetData() []byte {
+type GetFileInfoResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	File          *FileInfo              `protobuf:"bytes,1,opt,name=file,proto3" json:"file,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetFileInfoResponse) Reset() {
+	*x = GetFileInfoResponse{}
+	mi := &file_protos_file_service_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetFileInfoResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetFileInfoResponse) ProtoMessage() {}
+
+func (x *GetFileInfoResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[12]
 	if x != nil {
-		return x.Data
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetFileInfoResponse.ProtoReflect.Descriptor instead.
+func (*GetFileInfoResponse) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *GetFileInfoResponse) GetFile() *FileInfo {
+	if x != nil {
+		return x.File
 	}
 	return nil
 }
 
-type UploadFileResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+type StreamFilesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Сколько файлов отправлять в одном сообщении, 0 - значение по умолчанию сервера.
+	BatchSize  int32  `protobuf:"varint,1,opt,name=batch_size,json=batchSize,proto3" json:"batch_size,omitempty"`
+	NamePrefix string `protobuf:"bytes,2,opt,name=name_prefix,json=namePrefix,proto3" json:"name_prefix,omitempty"`
+	// Шаблон имени в синтаксисе path.Match, например "*.png".
+	NameGlob      string `protobuf:"bytes,3,opt,name=name_glob,json=nameGlob,proto3" json:"name_glob,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *UploadFileResponse) Reset() {
-	*x = UploadFileResponse{}
-	mi := &file_protos_file_service_proto_msgTypes[1]
+func (x *StreamFilesRequest) Reset() {
+	*x = StreamFilesRequest{}
+	mi := &file_protos_file_service_proto_msgTypes[13]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *UploadFileResponse) String() string {
+func (x *StreamFilesRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*UploadFileResponse) ProtoMessage() {}
+func (*StreamFilesRequest) ProtoMessage() {}
 
-func (x *UploadFileResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_file_service_proto_msgTypes[1]
+func (x *StreamFilesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[13]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -105,39 +1102,55 @@ func (x *UploadFileResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use UploadFileResponse.ProtoReflect.Descriptor instead.
-func (*UploadFileResponse) Descriptor() ([]byte, []int) {
-	return file_protos_file_service_proto_rawDescGZIP(), []int{1}
+// Deprecated: Use StreamFilesRequest.ProtoReflect.Descriptor instead.
+func (*StreamFilesRequest) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{13}
 }
 
-func (x *UploadFileResponse) GetMessage() string {
+func (x *StreamFilesRequest) GetBatchSize() int32 {
 	if x != nil {
-		return x.Message
+		return x.BatchSize
+	}
+	return 0
+}
+
+func (x *StreamFilesRequest) GetNamePrefix() string {
+	if x != nil {
+		return x.NamePrefix
 	}
 	return ""
 }
 
-type ListFilesRequest struct {
+func (x *StreamFilesRequest) GetNameGlob() string {
+	if x != nil {
+		return x.NameGlob
+	}
+	return ""
+}
+
+// Файлы приходят в порядке чтения каталога, без сортировки.
+type StreamFilesResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
+	Files         []*FileInfo            `protobuf:"bytes,1,rep,name=files,proto3" json:"files,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *ListFilesRequest) Reset() {
-	*x = ListFilesRequest{}
-	mi := &file_protos_file_service_proto_msgTypes[2]
+func (x *StreamFilesResponse) Reset() {
+	*x = StreamFilesResponse{}
+	mi := &file_protos_file_service_proto_msgTypes[14]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *ListFilesRequest) String() string {
+func (x *StreamFilesResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ListFilesRequest) ProtoMessage() {}
+func (*StreamFilesResponse) ProtoMessage() {}
 
-func (x *ListFilesRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_file_service_proto_msgTypes[2]
+func (x *StreamFilesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[14]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -148,33 +1161,102 @@ func (x *ListFilesRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ListFilesRequest.ProtoReflect.Descriptor instead.
-func (*ListFilesRequest) Descriptor() ([]byte, []int) {
-	return file_protos_file_service_proto_rawDescGZIP(), []int{2}
+// Deprecated: Use StreamFilesResponse.ProtoReflect.Descriptor instead.
+func (*StreamFilesResponse) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{14}
 }
 
-type ListFilesResponse struct {
+func (x *StreamFilesResponse) GetFiles() []*FileInfo {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+type StartUploadRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Filename string                 `protobuf:"bytes,1,opt,name=filename,proto3" json:"filename,omitempty"`
+	// Политика применяется при CommitUpload.
+	Overwrite     UploadHeader_OverwritePolicy `protobuf:"varint,2,opt,name=overwrite,proto3,enum=proto.UploadHeader_OverwritePolicy" json:"overwrite,omitempty"`
+	IfMatch       string                       `protobuf:"bytes,3,opt,name=if_match,json=ifMatch,proto3" json:"if_match,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StartUploadRequest) Reset() {
+	*x = StartUploadRequest{}
+	mi := &file_protos_file_service_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StartUploadRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StartUploadRequest) ProtoMessage() {}
+
+func (x *StartUploadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StartUploadRequest.ProtoReflect.Descriptor instead.
+func (*StartUploadRequest) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *StartUploadRequest) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *StartUploadRequest) GetOverwrite() UploadHeader_OverwritePolicy {
+	if x != nil {
+		return x.Overwrite
+	}
+	return UploadHeader_OVERWRITE
+}
+
+func (x *StartUploadRequest) GetIfMatch() string {
+	if x != nil {
+		return x.IfMatch
+	}
+	return ""
+}
+
+type StartUploadResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Files         []*FileInfo            `protobuf:"bytes,1,rep,name=files,proto3" json:"files,omitempty"`
+	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	ExpiresAt     string                 `protobuf:"bytes,2,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *ListFilesResponse) Reset() {
-	*x = ListFilesResponse{}
-	mi := &file_protos_file_service_proto_msgTypes[3]
+func (x *StartUploadResponse) Reset() {
+	*x = StartUploadResponse{}
+	mi := &file_protos_file_service_proto_msgTypes[16]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *ListFilesResponse) String() string {
+func (x *StartUploadResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ListFilesResponse) ProtoMessage() {}
+func (*StartUploadResponse) ProtoMessage() {}
 
-func (x *ListFilesResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_file_service_proto_msgTypes[3]
+func (x *StartUploadResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[16]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -185,42 +1267,47 @@ func (x *ListFilesResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ListFilesResponse.ProtoReflect.Descriptor instead.
-func (*ListFilesResponse) Descriptor() ([]byte, []int) {
-	return file_protos_file_service_proto_rawDescGZIP(), []int{3}
+// Deprecated: Use StartUploadResponse.ProtoReflect.Descriptor instead.
+func (*StartUploadResponse) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{16}
 }
 
-func (x *ListFilesResponse) GetFiles() []*FileInfo {
+func (x *StartUploadResponse) GetSessionId() string {
 	if x != nil {
-		return x.Files
+		return x.SessionId
 	}
-	return nil
+	return ""
 }
 
-type FileInfo struct {
+func (x *StartUploadResponse) GetExpiresAt() string {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return ""
+}
+
+type GetUploadStatusRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Filename      string                 `protobuf:"bytes,1,opt,name=filename,proto3" json:"filename,omitempty"`
-	CreatedAt     string                 `protobuf:"bytes,2,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
-	UpdatedAt     string                 `protobuf:"bytes,3,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *FileInfo) Reset() {
-	*x = FileInfo{}
-	mi := &file_protos_file_service_proto_msgTypes[4]
+func (x *GetUploadStatusRequest) Reset() {
+	*x = GetUploadStatusRequest{}
+	mi := &file_protos_file_service_proto_msgTypes[17]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *FileInfo) String() string {
+func (x *GetUploadStatusRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*FileInfo) ProtoMessage() {}
+func (*GetUploadStatusRequest) ProtoMessage() {}
 
-func (x *FileInfo) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_file_service_proto_msgTypes[4]
+func (x *GetUploadStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[17]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -231,54 +1318,110 @@ func (x *FileInfo) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use FileInfo.ProtoReflect.Descriptor instead.
-func (*FileInfo) Descriptor() ([]byte, []int) {
-	return file_protos_file_service_proto_rawDescGZIP(), []int{4}
+// Deprecated: Use GetUploadStatusRequest.ProtoReflect.Descriptor instead.
+func (*GetUploadStatusRequest) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{17}
 }
 
-func (x *FileInfo) GetFilename() string {
+func (x *GetUploadStatusRequest) GetSessionId() string {
 	if x != nil {
-		return x.Filename
+		return x.SessionId
 	}
 	return ""
 }
 
-func (x *FileInfo) GetCreatedAt() string {
+type GetUploadStatusResponse struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	SessionId       string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	Filename        string                 `protobuf:"bytes,2,opt,name=filename,proto3" json:"filename,omitempty"`
+	CommittedOffset int64                  `protobuf:"varint,3,opt,name=committed_offset,json=committedOffset,proto3" json:"committed_offset,omitempty"`
+	ExpiresAt       string                 `protobuf:"bytes,4,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *GetUploadStatusResponse) Reset() {
+	*x = GetUploadStatusResponse{}
+	mi := &file_protos_file_service_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetUploadStatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetUploadStatusResponse) ProtoMessage() {}
+
+func (x *GetUploadStatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[18]
 	if x != nil {
-		return x.CreatedAt
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetUploadStatusResponse.ProtoReflect.Descriptor instead.
+func (*GetUploadStatusResponse) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *GetUploadStatusResponse) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
 	}
 	return ""
 }
 
-func (x *FileInfo) GetUpdatedAt() string {
+func (x *GetUploadStatusResponse) GetFilename() string {
 	if x != nil {
-		return x.UpdatedAt
+		return x.Filename
 	}
 	return ""
 }
 
-type DownloadFileRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Filename      string                 `protobuf:"bytes,1,opt,name=filename,proto3" json:"filename,omitempty"`
+func (x *GetUploadStatusResponse) GetCommittedOffset() int64 {
+	if x != nil {
+		return x.CommittedOffset
+	}
+	return 0
+}
+
+func (x *GetUploadStatusResponse) GetExpiresAt() string {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return ""
+}
+
+type CommitUploadRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	SessionId string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	// Ожидаемый SHA-256 всего файла в hex.
+	Sha256        string `protobuf:"bytes,2,opt,name=sha256,proto3" json:"sha256,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *DownloadFileRequest) Reset() {
-	*x = DownloadFileRequest{}
-	mi := &file_protos_file_service_proto_msgTypes[5]
+func (x *CommitUploadRequest) Reset() {
+	*x = CommitUploadRequest{}
+	mi := &file_protos_file_service_proto_msgTypes[19]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *DownloadFileRequest) String() string {
+func (x *CommitUploadRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*DownloadFileRequest) ProtoMessage() {}
+func (*CommitUploadRequest) ProtoMessage() {}
 
-func (x *DownloadFileRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_file_service_proto_msgTypes[5]
+func (x *CommitUploadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[19]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -289,40 +1432,47 @@ func (x *DownloadFileRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use DownloadFileRequest.ProtoReflect.Descriptor instead.
-func (*DownloadFileRequest) Descriptor() ([]byte, []int) {
-	return file_protos_file_service_proto_rawDescGZIP(), []int{5}
+// Deprecated: Use CommitUploadRequest.ProtoReflect.Descriptor instead.
+func (*CommitUploadRequest) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{19}
 }
 
-func (x *DownloadFileRequest) GetFilename() string {
+func (x *CommitUploadRequest) GetSessionId() string {
 	if x != nil {
-		return x.Filename
+		return x.SessionId
 	}
 	return ""
 }
 
-type DownloadFileResponse struct {
+func (x *CommitUploadRequest) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+type CommitUploadResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	File          *FileInfo              `protobuf:"bytes,1,opt,name=file,proto3" json:"file,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *DownloadFileResponse) Reset() {
-	*x = DownloadFileResponse{}
-	mi := &file_protos_file_service_proto_msgTypes[6]
+func (x *CommitUploadResponse) Reset() {
+	*x = CommitUploadResponse{}
+	mi := &file_protos_file_service_proto_msgTypes[20]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *DownloadFileResponse) String() string {
+func (x *CommitUploadResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*DownloadFileResponse) ProtoMessage() {}
+func (*CommitUploadResponse) ProtoMessage() {}
 
-func (x *DownloadFileResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_file_service_proto_msgTypes[6]
+func (x *CommitUploadResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_file_service_proto_msgTypes[20]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -333,14 +1483,14 @@ func (x *DownloadFileResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use DownloadFileResponse.ProtoReflect.Descriptor instead.
-func (*DownloadFileResponse) Descriptor() ([]byte, []int) {
-	return file_protos_file_service_proto_rawDescGZIP(), []int{6}
+// Deprecated: Use CommitUploadResponse.ProtoReflect.Descriptor instead.
+func (*CommitUploadResponse) Descriptor() ([]byte, []int) {
+	return file_protos_file_service_proto_rawDescGZIP(), []int{20}
 }
 
-func (x *DownloadFileResponse) GetData() []byte {
+func (x *CommitUploadResponse) GetFile() *FileInfo {
 	if x != nil {
-		return x.Data
+		return x.File
 	}
 	return nil
 }
@@ -349,30 +1499,140 @@ var File_protos_file_service_proto protoreflect.FileDescriptor
 
 const file_protos_file_service_proto_rawDesc = "" +
 	"\n" +
-	"\x19protos/file_service.proto\x12\x05proto\"C\n" +
+	"\x19protos/file_service.proto\x12\x05proto\"\xba\x01\n" +
 	"\x11UploadFileRequest\x12\x1a\n" +
 	"\bfilename\x18\x01 \x01(\tR\bfilename\x12\x12\n" +
-	"\x04data\x18\x02 \x01(\fR\x04data\".\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x03 \x01(\tR\tsessionId\x12\x16\n" +
+	"\x06offset\x18\x04 \x01(\x03R\x06offset\x12\x16\n" +
+	"\x06sha256\x18\x05 \x01(\tR\x06sha256\x12\x1b\n" +
+	"\x06crc32c\x18\x06 \x01(\rH\x00R\x06crc32c\x88\x01\x01B\t\n" +
+	"\a_crc32c\"\xba\x02\n" +
+	"\fUploadHeader\x12\x1a\n" +
+	"\bfilename\x18\x01 \x01(\tR\bfilename\x12\x17\n" +
+	"\x04size\x18\x02 \x01(\x03H\x00R\x04size\x88\x01\x01\x12!\n" +
+	"\fcontent_type\x18\x03 \x01(\tR\vcontentType\x12\x16\n" +
+	"\x06sha256\x18\x04 \x01(\tR\x06sha256\x12A\n" +
+	"\toverwrite\x18\x05 \x01(\x0e2#.proto.UploadHeader.OverwritePolicyR\toverwrite\x12\x19\n" +
+	"\bif_match\x18\x06 \x01(\tR\aifMatch\"S\n" +
+	"\x0fOverwritePolicy\x12\r\n" +
+	"\tOVERWRITE\x10\x00\x12\x12\n" +
+	"\x0eFAIL_IF_EXISTS\x10\x01\x12\x0f\n" +
+	"\vAUTO_RENAME\x10\x02\x12\f\n" +
+	"\bIF_MATCH\x10\x03B\a\n" +
+	"\x05_size\"\x8f\x01\n" +
+	"\x13UploadFileV2Request\x12-\n" +
+	"\x06header\x18\x01 \x01(\v2\x13.proto.UploadHeaderH\x00R\x06header\x12\x16\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunk\x12\x1b\n" +
+	"\x06crc32c\x18\x03 \x01(\rH\x01R\x06crc32c\x88\x01\x01B\t\n" +
+	"\apayloadB\t\n" +
+	"\a_crc32c\"\xa1\x01\n" +
 	"\x12UploadFileResponse\x12\x18\n" +
-	"\amessage\x18\x01 \x01(\tR\amessage\"\x12\n" +
-	"\x10ListFilesRequest\":\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12)\n" +
+	"\x10committed_offset\x18\x02 \x01(\x03R\x0fcommittedOffset\x12\x16\n" +
+	"\x06sha256\x18\x03 \x01(\tR\x06sha256\x12\x1a\n" +
+	"\bfilename\x18\x04 \x01(\tR\bfilename\x12\x12\n" +
+	"\x04etag\x18\x05 \x01(\tR\x04etag\"\xb9\x03\n" +
+	"\x10ListFilesRequest\x12\x1b\n" +
+	"\tpage_size\x18\x01 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x02 \x01(\tR\tpageToken\x12:\n" +
+	"\border_by\x18\x03 \x01(\x0e2\x1f.proto.ListFilesRequest.OrderByR\aorderBy\x12\x1e\n" +
+	"\n" +
+	"descending\x18\x04 \x01(\bR\n" +
+	"descending\x12\x1f\n" +
+	"\vname_prefix\x18\x05 \x01(\tR\n" +
+	"namePrefix\x12\x1b\n" +
+	"\tname_glob\x18\x06 \x01(\tR\bnameGlob\x12#\n" +
+	"\rcreated_after\x18\a \x01(\tR\fcreatedAfter\x12%\n" +
+	"\x0ecreated_before\x18\b \x01(\tR\rcreatedBefore\x12#\n" +
+	"\rupdated_after\x18\t \x01(\tR\fupdatedAfter\x12%\n" +
+	"\x0eupdated_before\x18\n" +
+	" \x01(\tR\rupdatedBefore\"7\n" +
+	"\aOrderBy\x12\b\n" +
+	"\x04NAME\x10\x00\x12\v\n" +
+	"\aCREATED\x10\x01\x12\v\n" +
+	"\aUPDATED\x10\x02\x12\b\n" +
+	"\x04SIZE\x10\x03\"b\n" +
 	"\x11ListFilesResponse\x12%\n" +
-	"\x05files\x18\x01 \x03(\v2\x0f.proto.FileInfoR\x05files\"d\n" +
+	"\x05files\x18\x01 \x03(\v2\x0f.proto.FileInfoR\x05files\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"\xc7\x01\n" +
 	"\bFileInfo\x12\x1a\n" +
 	"\bfilename\x18\x01 \x01(\tR\bfilename\x12\x1d\n" +
 	"\n" +
 	"created_at\x18\x02 \x01(\tR\tcreatedAt\x12\x1d\n" +
 	"\n" +
-	"updated_at\x18\x03 \x01(\tR\tupdatedAt\"1\n" +
+	"updated_at\x18\x03 \x01(\tR\tupdatedAt\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x03R\x04size\x12\x16\n" +
+	"\x06sha256\x18\x05 \x01(\tR\x06sha256\x12!\n" +
+	"\fcontent_type\x18\x06 \x01(\tR\vcontentType\x12\x12\n" +
+	"\x04etag\x18\a \x01(\tR\x04etag\"\xb1\x01\n" +
 	"\x13DownloadFileRequest\x12\x1a\n" +
-	"\bfilename\x18\x01 \x01(\tR\bfilename\"*\n" +
+	"\bfilename\x18\x01 \x01(\tR\bfilename\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x03R\x06offset\x12\x16\n" +
+	"\x06length\x18\x03 \x01(\x03R\x06length\x12\"\n" +
+	"\rif_none_match\x18\x04 \x01(\tR\vifNoneMatch\x12*\n" +
+	"\x11if_modified_since\x18\x05 \x01(\tR\x0fifModifiedSince\"l\n" +
 	"\x14DownloadFileResponse\x12\x12\n" +
-	"\x04data\x18\x01 \x01(\fR\x04data2\xdd\x01\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\x12\x1d\n" +
+	"\n" +
+	"total_size\x18\x02 \x01(\x03R\ttotalSize\x12!\n" +
+	"\fnot_modified\x18\x03 \x01(\bR\vnotModified\"/\n" +
+	"\x11DeleteFileRequest\x12\x1a\n" +
+	"\bfilename\x18\x01 \x01(\tR\bfilename\".\n" +
+	"\x12DeleteFileResponse\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\"0\n" +
+	"\x12GetFileInfoRequest\x12\x1a\n" +
+	"\bfilename\x18\x01 \x01(\tR\bfilename\":\n" +
+	"\x13GetFileInfoResponse\x12#\n" +
+	"\x04file\x18\x01 \x01(\v2\x0f.proto.FileInfoR\x04file\"q\n" +
+	"\x12StreamFilesRequest\x12\x1d\n" +
+	"\n" +
+	"batch_size\x18\x01 \x01(\x05R\tbatchSize\x12\x1f\n" +
+	"\vname_prefix\x18\x02 \x01(\tR\n" +
+	"namePrefix\x12\x1b\n" +
+	"\tname_glob\x18\x03 \x01(\tR\bnameGlob\"<\n" +
+	"\x13StreamFilesResponse\x12%\n" +
+	"\x05files\x18\x01 \x03(\v2\x0f.proto.FileInfoR\x05files\"\x8e\x01\n" +
+	"\x12StartUploadRequest\x12\x1a\n" +
+	"\bfilename\x18\x01 \x01(\tR\bfilename\x12A\n" +
+	"\toverwrite\x18\x02 \x01(\x0e2#.proto.UploadHeader.OverwritePolicyR\toverwrite\x12\x19\n" +
+	"\bif_match\x18\x03 \x01(\tR\aifMatch\"S\n" +
+	"\x13StartUploadResponse\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x1d\n" +
+	"\n" +
+	"expires_at\x18\x02 \x01(\tR\texpiresAt\"7\n" +
+	"\x16GetUploadStatusRequest\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\"\x9e\x01\n" +
+	"\x17GetUploadStatusResponse\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x1a\n" +
+	"\bfilename\x18\x02 \x01(\tR\bfilename\x12)\n" +
+	"\x10committed_offset\x18\x03 \x01(\x03R\x0fcommittedOffset\x12\x1d\n" +
+	"\n" +
+	"expires_at\x18\x04 \x01(\tR\texpiresAt\"L\n" +
+	"\x13CommitUploadRequest\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x16\n" +
+	"\x06sha256\x18\x02 \x01(\tR\x06sha256\";\n" +
+	"\x14CommitUploadResponse\x12#\n" +
+	"\x04file\x18\x01 \x01(\v2\x0f.proto.FileInfoR\x04file2\xd8\x05\n" +
 	"\vFileService\x12C\n" +
 	"\n" +
-	"UploadFile\x12\x18.proto.UploadFileRequest\x1a\x19.proto.UploadFileResponse(\x01\x12>\n" +
+	"UploadFile\x12\x18.proto.UploadFileRequest\x1a\x19.proto.UploadFileResponse(\x01\x12G\n" +
+	"\fUploadFileV2\x12\x1a.proto.UploadFileV2Request\x1a\x19.proto.UploadFileResponse(\x01\x12>\n" +
 	"\tListFiles\x12\x17.proto.ListFilesRequest\x1a\x18.proto.ListFilesResponse\x12I\n" +
-	"\fDownloadFile\x12\x1a.proto.DownloadFileRequest\x1a\x1b.proto.DownloadFileResponse0\x01B\x13Z\x11/protos;gen_protob\x06proto3"
+	"\fDownloadFile\x12\x1a.proto.DownloadFileRequest\x1a\x1b.proto.DownloadFileResponse0\x01\x12A\n" +
+	"\n" +
+	"DeleteFile\x12\x18.proto.DeleteFileRequest\x1a\x19.proto.DeleteFileResponse\x12D\n" +
+	"\vGetFileInfo\x12\x19.proto.GetFileInfoRequest\x1a\x1a.proto.GetFileInfoResponse\x12F\n" +
+	"\vStreamFiles\x12\x19.proto.StreamFilesRequest\x1a\x1a.proto.StreamFilesResponse0\x01\x12D\n" +
+	"\vStartUpload\x12\x19.proto.StartUploadRequest\x1a\x1a.proto.StartUploadResponse\x12P\n" +
+	"\x0fGetUploadStatus\x12\x1d.proto.GetUploadStatusRequest\x1a\x1e.proto.GetUploadStatusResponse\x12G\n" +
+	"\fCommitUpload\x12\x1a.proto.CommitUploadRequest\x1a\x1b.proto.CommitUploadResponseB\x13Z\x11/protos;gen_protob\x06proto3"
 
 var (
 	file_protos_file_service_proto_rawDescOnce sync.Once
@@ -386,29 +1646,67 @@ func file_protos_file_service_proto_rawDescGZIP() []byte {
 	return file_protos_file_service_proto_rawDescData
 }
 
-var file_protos_file_service_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_protos_file_service_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_protos_file_service_proto_msgTypes = make([]protoimpl.MessageInfo, 21)
 var file_protos_file_service_proto_goTypes = []any{
-	(*UploadFileRequest)(nil),    // 0: proto.UploadFileRequest
-	(*UploadFileResponse)(nil),   // 1: proto.UploadFileResponse
-	(*ListFilesRequest)(nil),     // 2: proto.ListFilesRequest
-	(*ListFilesResponse)(nil),    // 3: proto.ListFilesResponse
-	(*FileInfo)(nil),             // 4: proto.FileInfo
-	(*DownloadFileRequest)(nil),  // 5: proto.DownloadFileRequest
-	(*DownloadFileResponse)(nil), // 6: proto.DownloadFileResponse
+	(UploadHeader_OverwritePolicy)(0), // 0: proto.UploadHeader.OverwritePolicy
+	(ListFilesRequest_OrderBy)(0),     // 1: proto.ListFilesRequest.OrderBy
+	(*UploadFileRequest)(nil),         // 2: proto.UploadFileRequest
+	(*UploadHeader)(nil),              // 3: proto.UploadHeader
+	(*UploadFileV2Request)(nil),       // 4: proto.UploadFileV2Request
+	(*UploadFileResponse)(nil),        // 5: proto.UploadFileResponse
+	(*ListFilesRequest)(nil),          // 6: proto.ListFilesRequest
+	(*ListFilesResponse)(nil),         // 7: proto.ListFilesResponse
+	(*FileInfo)(nil),                  // 8: proto.FileInfo
+	(*DownloadFileRequest)(nil),       // 9: proto.DownloadFileRequest
+	(*DownloadFileResponse)(nil),      // 10: proto.DownloadFileResponse
+	(*DeleteFileRequest)(nil),         // 11: proto.DeleteFileRequest
+	(*DeleteFileResponse)(nil),        // 12: proto.DeleteFileResponse
+	(*GetFileInfoRequest)(nil),        // 13: proto.GetFileInfoRequest
+	(*GetFileInfoResponse)(nil),       // 14: proto.GetFileInfoResponse
+	(*StreamFilesRequest)(nil),        // 15: proto.StreamFilesRequest
+	(*StreamFilesResponse)(nil),       // 16: proto.StreamFilesResponse
+	(*StartUploadRequest)(nil),        // 17: proto.StartUploadRequest
+	(*StartUploadResponse)(nil),       // 18: proto.StartUploadResponse
+	(*GetUploadStatusRequest)(nil),    // 19: proto.GetUploadStatusRequest
+	(*GetUploadStatusResponse)(nil),   // 20: proto.GetUploadStatusResponse
+	(*CommitUploadRequest)(nil),       // 21: proto.CommitUploadRequest
+	(*CommitUploadResponse)(nil),      // 22: proto.CommitUploadResponse
 }
 var file_protos_file_service_proto_depIdxs = []int32{
-	4, // 0: proto.ListFilesResponse.files:type_name -> proto.FileInfo
-	0, // 1: proto.FileService.UploadFile:input_type -> proto.UploadFileRequest
-	2, // 2: proto.FileService.ListFiles:input_type -> proto.ListFilesRequest
-	5, // 3: proto.FileService.DownloadFile:input_type -> proto.DownloadFileRequest
-	1, // 4: proto.FileService.UploadFile:output_type -> proto.UploadFileResponse
-	3, // 5: proto.FileService.ListFiles:output_type -> proto.ListFilesResponse
-	6, // 6: proto.FileService.DownloadFile:output_type -> proto.DownloadFileResponse
-	4, // [4:7] is the sub-list for method output_type
-	1, // [1:4] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	0,  // 0: proto.UploadHeader.overwrite:type_name -> proto.UploadHeader.OverwritePolicy
+	3,  // 1: proto.UploadFileV2Request.header:type_name -> proto.UploadHeader
+	1,  // 2: proto.ListFilesRequest.order_by:type_name -> proto.ListFilesRequest.OrderBy
+	8,  // 3: proto.ListFilesResponse.files:type_name -> proto.FileInfo
+	8,  // 4: proto.GetFileInfoResponse.file:type_name -> proto.FileInfo
+	8,  // 5: proto.StreamFilesResponse.files:type_name -> proto.FileInfo
+	0,  // 6: proto.StartUploadRequest.overwrite:type_name -> proto.UploadHeader.OverwritePolicy
+	8,  // 7: proto.CommitUploadResponse.file:type_name -> proto.FileInfo
+	2,  // 8: proto.FileService.UploadFile:input_type -> proto.UploadFileRequest
+	4,  // 9: proto.FileService.UploadFileV2:input_type -> proto.UploadFileV2Request
+	6,  // 10: proto.FileService.ListFiles:input_type -> proto.ListFilesRequest
+	9,  // 11: proto.FileService.DownloadFile:input_type -> proto.DownloadFileRequest
+	11, // 12: proto.FileService.DeleteFile:input_type -> proto.DeleteFileRequest
+	13, // 13: proto.FileService.GetFileInfo:input_type -> proto.GetFileInfoRequest
+	15, // 14: proto.FileService.StreamFiles:input_type -> proto.StreamFilesRequest
+	17, // 15: proto.FileService.StartUpload:input_type -> proto.StartUploadRequest
+	19, // 16: proto.FileService.GetUploadStatus:input_type -> proto.GetUploadStatusRequest
+	21, // 17: proto.FileService.CommitUpload:input_type -> proto.CommitUploadRequest
+	5,  // 18: proto.FileService.UploadFile:output_type -> proto.UploadFileResponse
+	5,  // 19: proto.FileService.UploadFileV2:output_type -> proto.UploadFileResponse
+	7,  // 20: proto.FileService.ListFiles:output_type -> proto.ListFilesResponse
+	10, // 21: proto.FileService.DownloadFile:output_type -> proto.DownloadFileResponse
+	12, // 22: proto.FileService.DeleteFile:output_type -> proto.DeleteFileResponse
+	14, // 23: proto.FileService.GetFileInfo:output_type -> proto.GetFileInfoResponse
+	16, // 24: proto.FileService.StreamFiles:output_type -> proto.StreamFilesResponse
+	18, // 25: proto.FileService.StartUpload:output_type -> proto.StartUploadResponse
+	20, // 26: proto.FileService.GetUploadStatus:output_type -> proto.GetUploadStatusResponse
+	22, // 27: proto.FileService.CommitUpload:output_type -> proto.CommitUploadResponse
+	18, // [18:28] is the sub-list for method output_type
+	8,  // [8:18] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
 }
 
 func init() { file_protos_file_service_proto_init() }
@@ -416,18 +1714,25 @@ func file_protos_file_service_proto_init() {
 	if File_protos_file_service_proto != nil {
 		return
 	}
+	file_protos_file_service_proto_msgTypes[0].OneofWrappers = []any{}
+	file_protos_file_service_proto_msgTypes[1].OneofWrappers = []any{}
+	file_protos_file_service_proto_msgTypes[2].OneofWrappers = []any{
+		(*UploadFileV2Request_Header)(nil),
+		(*UploadFileV2Request_Chunk)(nil),
+	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_protos_file_service_proto_rawDesc), len(file_protos_file_service_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   7,
+			NumEnums:      2,
+			NumMessages:   21,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_protos_file_service_proto_goTypes,
 		DependencyIndexes: file_protos_file_service_proto_depIdxs,
+		EnumInfos:         file_protos_file_service_proto_enumTypes,
 		MessageInfos:      file_protos_file_service_proto_msgTypes,
 	}.Build()
 	File_protos_file_service_proto = out.File